@@ -0,0 +1,215 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"log"
+)
+
+// usesConfigMap reports whether the aws-auth ConfigMap needs to be managed for the model. Clusters in API mode, and
+// clusters in API_AND_CONFIG_MAP mode that don't declare KubernetesApiAccess, are managed through access entries only.
+func usesConfigMap(model *Model) bool {
+	if model.AuthenticationMode == nil {
+		return true
+	}
+	switch *model.AuthenticationMode {
+	case eks.AuthenticationModeApi:
+		return false
+	case eks.AuthenticationModeApiAndConfigMap:
+		return model.KubernetesApiAccess != nil
+	}
+	return true
+}
+
+func usesAccessEntries(model *Model) bool {
+	if model.AuthenticationMode == nil {
+		return false
+	}
+	return *model.AuthenticationMode != eks.AuthenticationModeConfigMap
+}
+
+func validateAccessEntries(model *Model) error {
+	if len(model.AccessEntries) > 0 && !usesAccessEntries(model) {
+		return invalidRequestError("AccessEntries require an AuthenticationMode of API or API_AND_CONFIG_MAP")
+	}
+	return nil
+}
+
+func accessConfigChanged(current Model, desired Model) bool {
+	if desired.AuthenticationMode == nil {
+		return false
+	}
+	return aws.StringValue(current.AuthenticationMode) != *desired.AuthenticationMode
+}
+
+func updateAccessConfig(svc eksiface.EKSAPI, model *Model) (*string, error) {
+	input := &eks.UpdateClusterConfigInput{
+		Name:         model.Name,
+		AccessConfig: &eks.UpdateAccessConfigRequest{AuthenticationMode: model.AuthenticationMode},
+	}
+	response, err := svc.UpdateClusterConfig(input)
+	if err != nil {
+		return nil, err
+	}
+	return response.Update.Id, nil
+}
+
+// reconcileAccessEntries creates or updates the access entries in the model along with their access policy
+// associations, and deletes the entries removed from the model since the previous invocation. Access entry
+// operations take effect immediately, so there is nothing to stabilize.
+func reconcileAccessEntries(svc eksiface.EKSAPI, desired *Model, previous *Model) error {
+	for _, principalArn := range removedAccessEntries(previous, desired) {
+		log.Printf("Deleting access entry %v...\n", *principalArn)
+		_, err := svc.DeleteAccessEntry(&eks.DeleteAccessEntryInput{ClusterName: desired.Name, PrincipalArn: principalArn})
+		if err != nil && !matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return err
+		}
+	}
+	for _, entry := range desired.AccessEntries {
+		err := putAccessEntry(svc, desired, entry)
+		if err != nil {
+			return err
+		}
+		err = reconcileAccessPolicies(svc, desired.Name, entry)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putAccessEntry(svc eksiface.EKSAPI, model *Model, entry AccessEntry) error {
+	response, err := svc.DescribeAccessEntry(&eks.DescribeAccessEntryInput{ClusterName: model.Name, PrincipalArn: entry.PrincipalArn})
+	if err != nil {
+		if !matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return err
+		}
+		log.Printf("Creating access entry %v...\n", *entry.PrincipalArn)
+		input := &eks.CreateAccessEntryInput{
+			ClusterName:  model.Name,
+			PrincipalArn: entry.PrincipalArn,
+			Username:     entry.Username,
+			Type:         entry.Type,
+		}
+		if entry.KubernetesGroups != nil {
+			input.KubernetesGroups = aws.StringSlice(entry.KubernetesGroups)
+		}
+		if model.Tags != nil && len(model.Tags) > 0 {
+			input.Tags = make(map[string]*string)
+			for _, tag := range model.Tags {
+				input.Tags[*tag.Key] = tag.Value
+			}
+		}
+		_, err = svc.CreateAccessEntry(input)
+		return err
+	}
+	current := response.AccessEntry
+	usernameChanged := entry.Username != nil && *entry.Username != aws.StringValue(current.Username)
+	groupsChanged := !slicesEqual(entry.KubernetesGroups, aws.StringValueSlice(current.KubernetesGroups)) &&
+		(len(entry.KubernetesGroups) > 0 || len(current.KubernetesGroups) > 0)
+	if !usernameChanged && !groupsChanged {
+		return nil
+	}
+	log.Printf("Updating access entry %v...\n", *entry.PrincipalArn)
+	input := &eks.UpdateAccessEntryInput{
+		ClusterName:      model.Name,
+		PrincipalArn:     entry.PrincipalArn,
+		KubernetesGroups: aws.StringSlice(entry.KubernetesGroups),
+	}
+	if usernameChanged {
+		input.Username = entry.Username
+	}
+	_, err = svc.UpdateAccessEntry(input)
+	return err
+}
+
+func reconcileAccessPolicies(svc eksiface.EKSAPI, clusterName *string, entry AccessEntry) error {
+	var associated []*eks.AssociatedAccessPolicy
+	input := &eks.ListAssociatedAccessPoliciesInput{ClusterName: clusterName, PrincipalArn: entry.PrincipalArn}
+	for {
+		response, err := svc.ListAssociatedAccessPolicies(input)
+		if err != nil {
+			return err
+		}
+		associated = append(associated, response.AssociatedAccessPolicies...)
+		if response.NextToken == nil {
+			break
+		}
+		input.NextToken = response.NextToken
+	}
+	for _, policy := range entry.AccessPolicies {
+		if accessPolicyAssociated(associated, policy) {
+			continue
+		}
+		log.Printf("Associating access policy %v with %v...\n", *policy.PolicyArn, *entry.PrincipalArn)
+		_, err := svc.AssociateAccessPolicy(&eks.AssociateAccessPolicyInput{
+			ClusterName:  clusterName,
+			PrincipalArn: entry.PrincipalArn,
+			PolicyArn:    policy.PolicyArn,
+			AccessScope: &eks.AccessScope{
+				Type:       policy.AccessScope.Type,
+				Namespaces: aws.StringSlice(policy.AccessScope.Namespaces),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, a := range associated {
+		found := false
+		for _, policy := range entry.AccessPolicies {
+			if *policy.PolicyArn == aws.StringValue(a.PolicyArn) {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		log.Printf("Disassociating access policy %v from %v...\n", *a.PolicyArn, *entry.PrincipalArn)
+		_, err := svc.DisassociateAccessPolicy(&eks.DisassociateAccessPolicyInput{
+			ClusterName:  clusterName,
+			PrincipalArn: entry.PrincipalArn,
+			PolicyArn:    a.PolicyArn,
+		})
+		if err != nil && !matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return err
+		}
+	}
+	return nil
+}
+
+func accessPolicyAssociated(associated []*eks.AssociatedAccessPolicy, policy AccessPolicy) bool {
+	for _, a := range associated {
+		if aws.StringValue(a.PolicyArn) != *policy.PolicyArn || a.AccessScope == nil {
+			continue
+		}
+		if aws.StringValue(a.AccessScope.Type) != *policy.AccessScope.Type {
+			return false
+		}
+		return slicesEqual(aws.StringValueSlice(a.AccessScope.Namespaces), policy.AccessScope.Namespaces) ||
+			(len(a.AccessScope.Namespaces) == 0 && len(policy.AccessScope.Namespaces) == 0)
+	}
+	return false
+}
+
+func removedAccessEntries(previous *Model, desired *Model) []*string {
+	if previous == nil {
+		return nil
+	}
+	var removed []*string
+	for _, p := range previous.AccessEntries {
+		found := false
+		for _, d := range desired.AccessEntries {
+			if *p.PrincipalArn == *d.PrincipalArn {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed = append(removed, p.PrincipalArn)
+		}
+	}
+	return removed
+}
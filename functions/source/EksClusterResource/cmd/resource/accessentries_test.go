@@ -0,0 +1,237 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"reflect"
+	"testing"
+)
+
+func TestValidateAccessEntries(t *testing.T) {
+	entries := []AccessEntry{{PrincipalArn: aws.String("arn:aws:iam::123456789012:role/admin")}}
+	tests := map[string]struct {
+		mode    *string
+		entries []AccessEntry
+		invalid bool
+	}{
+		"no entries": {},
+		"api": {
+			mode:    aws.String(eks.AuthenticationModeApi),
+			entries: entries,
+		},
+		"api and config map": {
+			mode:    aws.String(eks.AuthenticationModeApiAndConfigMap),
+			entries: entries,
+		},
+		"config map": {
+			mode:    aws.String(eks.AuthenticationModeConfigMap),
+			entries: entries,
+			invalid: true,
+		},
+		"default mode": {
+			entries: entries,
+			invalid: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateAccessEntries(&Model{AuthenticationMode: tc.mode, AccessEntries: tc.entries})
+			if tc.invalid != matchesAwsErrorCode(err, eks.ErrCodeInvalidParameterException) || (!tc.invalid && err != nil) {
+				t.Errorf("expected invalid to be %v, got %v", tc.invalid, err)
+			}
+		})
+	}
+}
+
+func TestAccessConfigChanged(t *testing.T) {
+	tests := map[string]struct {
+		current  *string
+		desired  *string
+		expected bool
+	}{
+		"not set":   {current: aws.String(eks.AuthenticationModeConfigMap)},
+		"unchanged": {current: aws.String(eks.AuthenticationModeApi), desired: aws.String(eks.AuthenticationModeApi)},
+		"changed": {
+			current:  aws.String(eks.AuthenticationModeConfigMap),
+			desired:  aws.String(eks.AuthenticationModeApiAndConfigMap),
+			expected: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			changed := accessConfigChanged(Model{AuthenticationMode: tc.current}, Model{AuthenticationMode: tc.desired})
+			if changed != tc.expected {
+				t.Errorf("expected changed to be %v, got %v", tc.expected, changed)
+			}
+		})
+	}
+}
+
+func TestAccessPolicyAssociated(t *testing.T) {
+	viewPolicy := "arn:aws:eks::aws:cluster-access-policy/AmazonEKSViewPolicy"
+	associated := []*eks.AssociatedAccessPolicy{{
+		PolicyArn:   aws.String(viewPolicy),
+		AccessScope: &eks.AccessScope{Type: aws.String(eks.AccessScopeTypeNamespace), Namespaces: aws.StringSlice([]string{"apps", "jobs"})},
+	}}
+	tests := map[string]struct {
+		policy   AccessPolicy
+		expected bool
+	}{
+		"same scope": {
+			policy:   AccessPolicy{PolicyArn: aws.String(viewPolicy), AccessScope: &AccessScope{Type: aws.String(eks.AccessScopeTypeNamespace), Namespaces: []string{"jobs", "apps"}}},
+			expected: true,
+		},
+		"other namespaces": {
+			policy: AccessPolicy{PolicyArn: aws.String(viewPolicy), AccessScope: &AccessScope{Type: aws.String(eks.AccessScopeTypeNamespace), Namespaces: []string{"apps"}}},
+		},
+		"cluster scope": {
+			policy: AccessPolicy{PolicyArn: aws.String(viewPolicy), AccessScope: &AccessScope{Type: aws.String(eks.AccessScopeTypeCluster)}},
+		},
+		"other policy": {
+			policy: AccessPolicy{PolicyArn: aws.String("arn:aws:eks::aws:cluster-access-policy/AmazonEKSEditPolicy"), AccessScope: &AccessScope{Type: aws.String(eks.AccessScopeTypeCluster)}},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if found := accessPolicyAssociated(associated, tc.policy); found != tc.expected {
+				t.Errorf("expected associated to be %v, got %v", tc.expected, found)
+			}
+		})
+	}
+}
+
+func TestRemovedAccessEntries(t *testing.T) {
+	admin := AccessEntry{PrincipalArn: aws.String("arn:aws:iam::123456789012:role/admin")}
+	viewer := AccessEntry{PrincipalArn: aws.String("arn:aws:iam::123456789012:role/viewer")}
+	tests := map[string]struct {
+		previous *Model
+		desired  *Model
+		expected []string
+	}{
+		"create": {
+			desired: &Model{AccessEntries: []AccessEntry{admin}},
+		},
+		"unchanged": {
+			previous: &Model{AccessEntries: []AccessEntry{admin, viewer}},
+			desired:  &Model{AccessEntries: []AccessEntry{viewer, admin}},
+		},
+		"removed": {
+			previous: &Model{AccessEntries: []AccessEntry{admin, viewer}},
+			desired:  &Model{AccessEntries: []AccessEntry{admin}},
+			expected: []string{*viewer.PrincipalArn},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			removed := aws.StringValueSlice(removedAccessEntries(tc.previous, tc.desired))
+			if len(removed) == 0 {
+				removed = nil
+			}
+			if !reflect.DeepEqual(removed, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, removed)
+			}
+		})
+	}
+}
+
+type mockAccessEntryClient struct {
+	mockEKSClient
+	entries  map[string]*eks.AccessEntry
+	policies []*eks.AssociatedAccessPolicy
+	calls    []string
+}
+
+func (m *mockAccessEntryClient) DescribeAccessEntry(input *eks.DescribeAccessEntryInput) (*eks.DescribeAccessEntryOutput, error) {
+	entry, ok := m.entries[*input.PrincipalArn]
+	if !ok {
+		return nil, awserr.New(eks.ErrCodeResourceNotFoundException, "access entry not found", nil)
+	}
+	return &eks.DescribeAccessEntryOutput{AccessEntry: entry}, nil
+}
+
+func (m *mockAccessEntryClient) CreateAccessEntry(input *eks.CreateAccessEntryInput) (*eks.CreateAccessEntryOutput, error) {
+	m.calls = append(m.calls, "CreateAccessEntry")
+	return &eks.CreateAccessEntryOutput{}, nil
+}
+
+func (m *mockAccessEntryClient) UpdateAccessEntry(input *eks.UpdateAccessEntryInput) (*eks.UpdateAccessEntryOutput, error) {
+	m.calls = append(m.calls, "UpdateAccessEntry")
+	return &eks.UpdateAccessEntryOutput{}, nil
+}
+
+func (m *mockAccessEntryClient) DeleteAccessEntry(input *eks.DeleteAccessEntryInput) (*eks.DeleteAccessEntryOutput, error) {
+	m.calls = append(m.calls, "DeleteAccessEntry")
+	return &eks.DeleteAccessEntryOutput{}, nil
+}
+
+func (m *mockAccessEntryClient) ListAssociatedAccessPolicies(*eks.ListAssociatedAccessPoliciesInput) (*eks.ListAssociatedAccessPoliciesOutput, error) {
+	return &eks.ListAssociatedAccessPoliciesOutput{AssociatedAccessPolicies: m.policies}, nil
+}
+
+func (m *mockAccessEntryClient) AssociateAccessPolicy(*eks.AssociateAccessPolicyInput) (*eks.AssociateAccessPolicyOutput, error) {
+	m.calls = append(m.calls, "AssociateAccessPolicy")
+	return &eks.AssociateAccessPolicyOutput{}, nil
+}
+
+func (m *mockAccessEntryClient) DisassociateAccessPolicy(*eks.DisassociateAccessPolicyInput) (*eks.DisassociateAccessPolicyOutput, error) {
+	m.calls = append(m.calls, "DisassociateAccessPolicy")
+	return &eks.DisassociateAccessPolicyOutput{}, nil
+}
+
+func TestReconcileAccessEntries(t *testing.T) {
+	admin := "arn:aws:iam::123456789012:role/admin"
+	adminPolicy := "arn:aws:eks::aws:cluster-access-policy/AmazonEKSClusterAdminPolicy"
+	viewPolicy := "arn:aws:eks::aws:cluster-access-policy/AmazonEKSViewPolicy"
+	clusterScope := &AccessScope{Type: aws.String(eks.AccessScopeTypeCluster)}
+	entry := AccessEntry{
+		PrincipalArn:     aws.String(admin),
+		KubernetesGroups: []string{"admins"},
+		AccessPolicies:   []AccessPolicy{{PolicyArn: aws.String(adminPolicy), AccessScope: clusterScope}},
+	}
+	associated := &eks.AssociatedAccessPolicy{PolicyArn: aws.String(adminPolicy), AccessScope: &eks.AccessScope{Type: aws.String(eks.AccessScopeTypeCluster)}}
+	tests := map[string]struct {
+		entries  map[string]*eks.AccessEntry
+		policies []*eks.AssociatedAccessPolicy
+		previous []AccessEntry
+		calls    []string
+	}{
+		"created": {
+			entries: map[string]*eks.AccessEntry{},
+			calls:   []string{"CreateAccessEntry", "AssociateAccessPolicy"},
+		},
+		"unchanged": {
+			entries:  map[string]*eks.AccessEntry{admin: {KubernetesGroups: aws.StringSlice([]string{"admins"})}},
+			policies: []*eks.AssociatedAccessPolicy{associated},
+		},
+		"groups and policies changed": {
+			entries: map[string]*eks.AccessEntry{admin: {KubernetesGroups: aws.StringSlice([]string{"viewers"})}},
+			policies: []*eks.AssociatedAccessPolicy{
+				{PolicyArn: aws.String(viewPolicy), AccessScope: &eks.AccessScope{Type: aws.String(eks.AccessScopeTypeCluster)}},
+			},
+			calls: []string{"UpdateAccessEntry", "AssociateAccessPolicy", "DisassociateAccessPolicy"},
+		},
+		"removed": {
+			entries:  map[string]*eks.AccessEntry{admin: {KubernetesGroups: aws.StringSlice([]string{"admins"})}},
+			policies: []*eks.AssociatedAccessPolicy{associated},
+			previous: []AccessEntry{entry, {PrincipalArn: aws.String("arn:aws:iam::123456789012:role/viewer")}},
+			calls:    []string{"DeleteAccessEntry"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockAccessEntryClient{entries: tc.entries, policies: tc.policies}
+			desired := &Model{Name: aws.String("cluster"), AccessEntries: []AccessEntry{entry}}
+			var previous *Model
+			if tc.previous != nil {
+				previous = &Model{Name: aws.String("cluster"), AccessEntries: tc.previous}
+			}
+			if err := reconcileAccessEntries(svc, desired, previous); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(svc.calls, tc.calls) {
+				t.Errorf("expected calls %v, got %v", tc.calls, svc.calls)
+			}
+		})
+	}
+}
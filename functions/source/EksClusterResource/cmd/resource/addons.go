@@ -0,0 +1,195 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"log"
+	"strings"
+)
+
+func makeCreateAddonInput(model *Model, addon Addon) *eks.CreateAddonInput {
+	input := &eks.CreateAddonInput{
+		ClusterName:           model.Name,
+		AddonName:             addon.Name,
+		AddonVersion:          addon.Version,
+		ServiceAccountRoleArn: addon.ServiceAccountRoleArn,
+		ConfigurationValues:   addon.ConfigurationValues,
+		ResolveConflicts:      addon.ResolveConflicts,
+	}
+	if model.Tags != nil && len(model.Tags) > 0 {
+		input.Tags = make(map[string]*string)
+		for _, tag := range model.Tags {
+			input.Tags[*tag.Key] = tag.Value
+		}
+	}
+	return input
+}
+
+// reconcileAddons creates missing add-ons, updates the ones whose version, service account role or configuration
+// differ, and deletes the add-ons removed from the model since the previous invocation. It returns Complete once
+// every add-on is ACTIVE.
+func reconcileAddons(svc eksiface.EKSAPI, desired *Model, previous *Model) (OperationComplete, error) {
+	complete := Complete
+	for _, addon := range removedAddons(previous, desired) {
+		deleted, err := deleteAddon(svc, desired.Name, addon)
+		if err != nil {
+			return Complete, err
+		}
+		if !deleted {
+			complete = InProgress
+		}
+	}
+	for _, addon := range desired.Addons {
+		response, err := svc.DescribeAddon(&eks.DescribeAddonInput{ClusterName: desired.Name, AddonName: addon.Name})
+		if err != nil {
+			if !matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+				return Complete, err
+			}
+			log.Printf("Creating add-on %v...\n", *addon.Name)
+			_, err = svc.CreateAddon(makeCreateAddonInput(desired, addon))
+			if err != nil {
+				return Complete, err
+			}
+			complete = InProgress
+			continue
+		}
+		current := response.Addon
+		switch *current.Status {
+		case eks.AddonStatusActive, eks.AddonStatusDegraded:
+			if input := makeUpdateAddonInput(desired.Name, addon, current); input != nil {
+				log.Printf("Updating add-on %v...\n", *addon.Name)
+				_, err = svc.UpdateAddon(input)
+				if err != nil && !matchesAwsErrorCode(err, eks.ErrCodeResourceInUseException) {
+					return Complete, err
+				}
+				complete = InProgress
+			} else if *current.Status != eks.AddonStatusActive {
+				complete = InProgress
+			}
+		case eks.AddonStatusCreateFailed, eks.AddonStatusUpdateFailed, eks.AddonStatusDeleteFailed:
+			return Complete, addonHealthError(current)
+		default:
+			complete = InProgress
+		}
+	}
+	return complete, nil
+}
+
+func makeUpdateAddonInput(clusterName *string, desired Addon, current *eks.Addon) *eks.UpdateAddonInput {
+	input := &eks.UpdateAddonInput{
+		ClusterName:      clusterName,
+		AddonName:        desired.Name,
+		ResolveConflicts: desired.ResolveConflicts,
+	}
+	changed := false
+	if desired.Version != nil && *desired.Version != aws.StringValue(current.AddonVersion) {
+		input.AddonVersion = desired.Version
+		changed = true
+	}
+	if desired.ServiceAccountRoleArn != nil && *desired.ServiceAccountRoleArn != aws.StringValue(current.ServiceAccountRoleArn) {
+		input.ServiceAccountRoleArn = desired.ServiceAccountRoleArn
+		changed = true
+	}
+	if desired.ConfigurationValues != nil && *desired.ConfigurationValues != aws.StringValue(current.ConfigurationValues) {
+		input.ConfigurationValues = desired.ConfigurationValues
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return input
+}
+
+func removedAddons(previous *Model, desired *Model) []Addon {
+	if previous == nil {
+		return nil
+	}
+	var removed []Addon
+	for _, p := range previous.Addons {
+		found := false
+		for _, d := range desired.Addons {
+			if *p.Name == *d.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed = append(removed, p)
+		}
+	}
+	return removed
+}
+
+// deleteAddons deletes every add-on installed on the cluster, keeping the software of the add-ons the model marks
+// with Preserve, and returns Complete once all are gone.
+func deleteAddons(svc eksiface.EKSAPI, model *Model) (OperationComplete, error) {
+	var names []*string
+	err := svc.ListAddonsPages(&eks.ListAddonsInput{ClusterName: model.Name}, func(page *eks.ListAddonsOutput, lastPage bool) bool {
+		names = append(names, page.Addons...)
+		return true
+	})
+	if err != nil {
+		if matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return Complete, nil
+		}
+		return Complete, err
+	}
+	complete := Complete
+	for _, name := range names {
+		addon := Addon{Name: name}
+		for _, a := range model.Addons {
+			if *a.Name == *name {
+				addon = a
+			}
+		}
+		deleted, err := deleteAddon(svc, model.Name, addon)
+		if err != nil {
+			return Complete, err
+		}
+		if !deleted {
+			complete = InProgress
+		}
+	}
+	return complete, nil
+}
+
+func deleteAddon(svc eksiface.EKSAPI, clusterName *string, addon Addon) (OperationComplete, error) {
+	response, err := svc.DescribeAddon(&eks.DescribeAddonInput{ClusterName: clusterName, AddonName: addon.Name})
+	if err != nil {
+		if matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return Complete, nil
+		}
+		return Complete, err
+	}
+	switch *response.Addon.Status {
+	case eks.AddonStatusDeleting:
+		return InProgress, nil
+	case eks.AddonStatusDeleteFailed:
+		return Complete, addonHealthError(response.Addon)
+	}
+	log.Printf("Deleting add-on %v...\n", *addon.Name)
+	_, err = svc.DeleteAddon(&eks.DeleteAddonInput{ClusterName: clusterName, AddonName: addon.Name, Preserve: addon.Preserve})
+	if err != nil {
+		if matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return Complete, nil
+		}
+		if matchesAwsErrorCode(err, eks.ErrCodeResourceInUseException) {
+			return InProgress, nil
+		}
+		return Complete, err
+	}
+	return InProgress, nil
+}
+
+func addonHealthError(addon *eks.Addon) error {
+	var issues []string
+	if addon.Health != nil {
+		for _, issue := range addon.Health.Issues {
+			issues = append(issues, fmt.Sprintf("[%v] %v", aws.StringValue(issue.Code), aws.StringValue(issue.Message)))
+		}
+	}
+	return errors.New(fmt.Sprintf("add-on %v status is %v: %v", *addon.AddonName, *addon.Status, strings.Join(issues, "; ")))
+}
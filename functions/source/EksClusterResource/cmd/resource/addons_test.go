@@ -0,0 +1,254 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMakeUpdateAddonInput(t *testing.T) {
+	current := &eks.Addon{
+		AddonName:             aws.String("vpc-cni"),
+		AddonVersion:          aws.String("v1.12.0-eksbuild.1"),
+		ServiceAccountRoleArn: aws.String("arn:aws:iam::123456789012:role/cni"),
+	}
+	tests := map[string]struct {
+		desired  Addon
+		expected *eks.UpdateAddonInput
+	}{
+		"unchanged": {
+			desired: Addon{Name: aws.String("vpc-cni"), Version: aws.String("v1.12.0-eksbuild.1")},
+		},
+		"defaults": {
+			desired: Addon{Name: aws.String("vpc-cni")},
+		},
+		"version": {
+			desired: Addon{Name: aws.String("vpc-cni"), Version: aws.String("v1.12.6-eksbuild.2"), ResolveConflicts: aws.String(eks.ResolveConflictsOverwrite)},
+			expected: &eks.UpdateAddonInput{
+				ClusterName:      aws.String("cluster"),
+				AddonName:        aws.String("vpc-cni"),
+				AddonVersion:     aws.String("v1.12.6-eksbuild.2"),
+				ResolveConflicts: aws.String(eks.ResolveConflictsOverwrite),
+			},
+		},
+		"role and configuration": {
+			desired: Addon{
+				Name:                  aws.String("vpc-cni"),
+				ServiceAccountRoleArn: aws.String("arn:aws:iam::123456789012:role/other"),
+				ConfigurationValues:   aws.String(`{"env":{"ENABLE_PREFIX_DELEGATION":"true"}}`),
+			},
+			expected: &eks.UpdateAddonInput{
+				ClusterName:           aws.String("cluster"),
+				AddonName:             aws.String("vpc-cni"),
+				ServiceAccountRoleArn: aws.String("arn:aws:iam::123456789012:role/other"),
+				ConfigurationValues:   aws.String(`{"env":{"ENABLE_PREFIX_DELEGATION":"true"}}`),
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			input := makeUpdateAddonInput(aws.String("cluster"), tc.desired, current)
+			if !reflect.DeepEqual(input, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, input)
+			}
+		})
+	}
+}
+
+func TestRemovedAddons(t *testing.T) {
+	cni := Addon{Name: aws.String("vpc-cni")}
+	dns := Addon{Name: aws.String("coredns"), Preserve: aws.Bool(true)}
+	tests := map[string]struct {
+		previous *Model
+		desired  *Model
+		expected []Addon
+	}{
+		"create": {
+			desired: &Model{Addons: []Addon{cni}},
+		},
+		"unchanged": {
+			previous: &Model{Addons: []Addon{cni, dns}},
+			desired:  &Model{Addons: []Addon{cni, dns}},
+		},
+		"removed": {
+			previous: &Model{Addons: []Addon{cni, dns}},
+			desired:  &Model{Addons: []Addon{cni}},
+			expected: []Addon{dns},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if removed := removedAddons(tc.previous, tc.desired); !reflect.DeepEqual(removed, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, removed)
+			}
+		})
+	}
+}
+
+type mockAddonClient struct {
+	mockEKSClient
+	addons    map[string]*eks.Addon
+	created   []string
+	updated   []string
+	deleted   []string
+	preserved []string
+}
+
+func (m *mockAddonClient) ListAddonsPages(_ *eks.ListAddonsInput, fn func(*eks.ListAddonsOutput, bool) bool) error {
+	var names []string
+	for name := range m.addons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fn(&eks.ListAddonsOutput{Addons: aws.StringSlice(names)}, true)
+	return nil
+}
+
+func (m *mockAddonClient) DescribeAddon(input *eks.DescribeAddonInput) (*eks.DescribeAddonOutput, error) {
+	addon, ok := m.addons[*input.AddonName]
+	if !ok {
+		return nil, awserr.New(eks.ErrCodeResourceNotFoundException, "add-on not found", nil)
+	}
+	return &eks.DescribeAddonOutput{Addon: addon}, nil
+}
+
+func (m *mockAddonClient) CreateAddon(input *eks.CreateAddonInput) (*eks.CreateAddonOutput, error) {
+	m.created = append(m.created, *input.AddonName)
+	return &eks.CreateAddonOutput{}, nil
+}
+
+func (m *mockAddonClient) UpdateAddon(input *eks.UpdateAddonInput) (*eks.UpdateAddonOutput, error) {
+	m.updated = append(m.updated, *input.AddonName)
+	return &eks.UpdateAddonOutput{}, nil
+}
+
+func (m *mockAddonClient) DeleteAddon(input *eks.DeleteAddonInput) (*eks.DeleteAddonOutput, error) {
+	m.deleted = append(m.deleted, *input.AddonName)
+	if aws.BoolValue(input.Preserve) {
+		m.preserved = append(m.preserved, *input.AddonName)
+	}
+	return &eks.DeleteAddonOutput{}, nil
+}
+
+func TestReconcileAddons(t *testing.T) {
+	active := func(name string, version string) *eks.Addon {
+		return &eks.Addon{AddonName: aws.String(name), AddonVersion: aws.String(version), Status: aws.String(eks.AddonStatusActive)}
+	}
+	tests := map[string]struct {
+		addons   map[string]*eks.Addon
+		desired  []Addon
+		previous []Addon
+		complete OperationComplete
+		created  []string
+		updated  []string
+		deleted  []string
+		failed   bool
+	}{
+		"active": {
+			addons:   map[string]*eks.Addon{"vpc-cni": active("vpc-cni", "v1")},
+			desired:  []Addon{{Name: aws.String("vpc-cni"), Version: aws.String("v1")}},
+			complete: Complete,
+		},
+		"created": {
+			addons:   map[string]*eks.Addon{},
+			desired:  []Addon{{Name: aws.String("vpc-cni")}},
+			complete: InProgress,
+			created:  []string{"vpc-cni"},
+		},
+		"updated": {
+			addons:   map[string]*eks.Addon{"vpc-cni": active("vpc-cni", "v1")},
+			desired:  []Addon{{Name: aws.String("vpc-cni"), Version: aws.String("v2")}},
+			complete: InProgress,
+			updated:  []string{"vpc-cni"},
+		},
+		"removed": {
+			addons:   map[string]*eks.Addon{"vpc-cni": active("vpc-cni", "v1"), "coredns": active("coredns", "v1")},
+			desired:  []Addon{{Name: aws.String("vpc-cni")}},
+			previous: []Addon{{Name: aws.String("vpc-cni")}, {Name: aws.String("coredns")}},
+			complete: InProgress,
+			deleted:  []string{"coredns"},
+		},
+		"creating": {
+			addons:   map[string]*eks.Addon{"vpc-cni": {AddonName: aws.String("vpc-cni"), Status: aws.String(eks.AddonStatusCreating)}},
+			desired:  []Addon{{Name: aws.String("vpc-cni")}},
+			complete: InProgress,
+		},
+		"create failed": {
+			addons:  map[string]*eks.Addon{"vpc-cni": {AddonName: aws.String("vpc-cni"), Status: aws.String(eks.AddonStatusCreateFailed)}},
+			desired: []Addon{{Name: aws.String("vpc-cni")}},
+			failed:  true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockAddonClient{addons: tc.addons}
+			desired := &Model{Name: aws.String("cluster"), Addons: tc.desired}
+			var previous *Model
+			if tc.previous != nil {
+				previous = &Model{Name: aws.String("cluster"), Addons: tc.previous}
+			}
+			complete, err := reconcileAddons(svc, desired, previous)
+			if tc.failed {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if complete != tc.complete {
+				t.Errorf("expected complete to be %v, got %v", tc.complete, complete)
+			}
+			if !reflect.DeepEqual(svc.created, tc.created) || !reflect.DeepEqual(svc.updated, tc.updated) || !reflect.DeepEqual(svc.deleted, tc.deleted) {
+				t.Errorf("expected created %v, updated %v and deleted %v, got %v, %v and %v",
+					tc.created, tc.updated, tc.deleted, svc.created, svc.updated, svc.deleted)
+			}
+		})
+	}
+}
+
+func TestDeleteAddons(t *testing.T) {
+	tests := map[string]struct {
+		addons    map[string]*eks.Addon
+		complete  OperationComplete
+		deleted   []string
+		preserved []string
+	}{
+		"none left": {
+			addons:   map[string]*eks.Addon{},
+			complete: Complete,
+		},
+		"deleted": {
+			addons: map[string]*eks.Addon{
+				"coredns": {AddonName: aws.String("coredns"), Status: aws.String(eks.AddonStatusActive)},
+				"vpc-cni": {AddonName: aws.String("vpc-cni"), Status: aws.String(eks.AddonStatusActive)},
+			},
+			complete:  InProgress,
+			deleted:   []string{"coredns", "vpc-cni"},
+			preserved: []string{"vpc-cni"},
+		},
+		"deleting": {
+			addons:   map[string]*eks.Addon{"coredns": {AddonName: aws.String("coredns"), Status: aws.String(eks.AddonStatusDeleting)}},
+			complete: InProgress,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockAddonClient{addons: tc.addons}
+			// add-ons installed outside of the model are deleted as well
+			model := &Model{Name: aws.String("cluster"), Addons: []Addon{{Name: aws.String("vpc-cni"), Preserve: aws.Bool(true)}}}
+			complete, err := deleteAddons(svc, model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if complete != tc.complete || !reflect.DeepEqual(svc.deleted, tc.deleted) || !reflect.DeepEqual(svc.preserved, tc.preserved) {
+				t.Errorf("expected complete %v after deleting %v preserving %v, got %v after deleting %v preserving %v",
+					tc.complete, tc.deleted, tc.preserved, complete, svc.deleted, svc.preserved)
+			}
+		})
+	}
+}
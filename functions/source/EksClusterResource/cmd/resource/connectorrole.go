@@ -0,0 +1,173 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"log"
+	"strings"
+)
+
+const (
+	defaultConnectorRoleName = "CloudFormation-Kubernetes-VPC"
+	connectorRolePolicyName  = "vpc-connector"
+	connectorRoleTagPrefix   = "awsqs.eks/"
+	connectorRoleManagedTag  = connectorRoleTagPrefix + "managed"
+	maxTagKeyLength          = 128
+	connectorRoleTrustPolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Effect": "Allow",
+      "Principal": {"Service": "lambda.amazonaws.com"},
+      "Action": "sts:AssumeRole"
+    }
+  ]
+}`
+	// the function only needs to attach to the VPC and authenticate to the cluster
+	connectorRolePolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Effect": "Allow",
+      "Action": [
+        "ec2:CreateNetworkInterface",
+        "ec2:DescribeNetworkInterfaces",
+        "ec2:DeleteNetworkInterface",
+        "ec2:AssignPrivateIpAddresses",
+        "ec2:UnassignPrivateIpAddresses"
+      ],
+      "Resource": "*"
+    },
+    {
+      "Effect": "Allow",
+      "Action": "eks:DescribeCluster",
+      "Resource": "arn:%[1]s:eks:*:%[2]s:cluster/*"
+    },
+    {
+      "Effect": "Allow",
+      "Action": "sts:GetCallerIdentity",
+      "Resource": "*"
+    }
+  ]
+}`
+)
+
+func createsConnectorRole(model *Model) bool {
+	return model.VpcConnector != nil && model.VpcConnector.CreateRole != nil && *model.VpcConnector.CreateRole
+}
+
+func connectorRoleName(model *Model) *string {
+	if model.LambdaRoleName != nil {
+		return model.LambdaRoleName
+	}
+	return aws.String(defaultConnectorRoleName)
+}
+
+// connectorRoleArn returns the ARN of the VPC connector role in the account of the caller.
+func connectorRoleArn(caller *string, model *Model) *string {
+	return aws.String(fmt.Sprintf("arn:%s:iam::%s:role/%s", *partitionFromArn(caller), *accountIdFromArn(caller), *connectorRoleName(model)))
+}
+
+// connectorRoleTagKey returns the tag that marks the connector role as referenced by the cluster. Roles are global,
+// so the region is part of the key to tell apart clusters of the same name. Names that would make the key longer
+// than IAM allows are replaced by their hash.
+func connectorRoleTagKey(model *Model, region string) *string {
+	key := fmt.Sprintf("%s%s/%s", connectorRoleTagPrefix, region, *model.Name)
+	if len(key) > maxTagKeyLength {
+		key = fmt.Sprintf("%s%s/%x", connectorRoleTagPrefix, region, sha256.Sum256([]byte(*model.Name)))
+	}
+	return aws.String(key)
+}
+
+// putConnectorRole creates the VPC connector role if it doesn't exist, tags it as referenced by the cluster and keeps
+// its inline policy limited to what the function needs. A role of that name that wasn't created by this resource
+// type is left alone and reported as an error.
+func putConnectorRole(svc iamiface.IAMAPI, model *Model, region string) error {
+	name := connectorRoleName(model)
+	tags := []*iam.Tag{{Key: connectorRoleTagKey(model, region), Value: aws.String("owned")}}
+	var arn *string
+	response, err := svc.GetRole(&iam.GetRoleInput{RoleName: name})
+	if err != nil {
+		if !matchesAwsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+			return err
+		}
+		log.Printf("Creating IAM role %v...\n", *name)
+		created, err := svc.CreateRole(&iam.CreateRoleInput{
+			RoleName:                 name,
+			Description:              aws.String("Used by the AWSQS::EKS::Cluster VPC connector function to reach private clusters"),
+			AssumeRolePolicyDocument: aws.String(connectorRoleTrustPolicy),
+			Tags:                     append(tags, &iam.Tag{Key: aws.String(connectorRoleManagedTag), Value: aws.String("true")}),
+		})
+		if err != nil {
+			return err
+		}
+		arn = created.Role.Arn
+	} else {
+		if !hasTag(response.Role.Tags, connectorRoleManagedTag) {
+			return invalidRequestError(fmt.Sprintf("IAM role %v already exists and was not created by this resource type, "+
+				"set LambdaRoleName to a different name or disable VpcConnector CreateRole", *name))
+		}
+		arn = response.Role.Arn
+		if !hasTag(response.Role.Tags, *tags[0].Key) {
+			_, err = svc.TagRole(&iam.TagRoleInput{RoleName: name, Tags: tags})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = svc.PutRolePolicy(&iam.PutRolePolicyInput{
+		RoleName:       name,
+		PolicyName:     aws.String(connectorRolePolicyName),
+		PolicyDocument: aws.String(fmt.Sprintf(connectorRolePolicy, *partitionFromArn(arn), *accountIdFromArn(arn))),
+	})
+	return err
+}
+
+// releaseConnectorRole removes the cluster's reference from the VPC connector role and deletes the role once no other
+// cluster references it.
+func releaseConnectorRole(svc iamiface.IAMAPI, model *Model, region string) error {
+	name := connectorRoleName(model)
+	key := connectorRoleTagKey(model, region)
+	_, err := svc.UntagRole(&iam.UntagRoleInput{RoleName: name, TagKeys: []*string{key}})
+	if err != nil {
+		if matchesAwsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+			return nil
+		}
+		return err
+	}
+	response, err := svc.ListRoleTags(&iam.ListRoleTagsInput{RoleName: name})
+	if err != nil {
+		return err
+	}
+	if !hasTag(response.Tags, connectorRoleManagedTag) {
+		return nil
+	}
+	for _, tag := range response.Tags {
+		if *tag.Key != connectorRoleManagedTag && strings.HasPrefix(*tag.Key, connectorRoleTagPrefix) {
+			log.Printf("IAM role %v is still referenced by %v\n", *name, strings.TrimPrefix(*tag.Key, connectorRoleTagPrefix))
+			return nil
+		}
+	}
+	log.Printf("Deleting IAM role %v...\n", *name)
+	_, err = svc.DeleteRolePolicy(&iam.DeleteRolePolicyInput{RoleName: name, PolicyName: aws.String(connectorRolePolicyName)})
+	if err != nil && !matchesAwsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+		return err
+	}
+	_, err = svc.DeleteRole(&iam.DeleteRoleInput{RoleName: name})
+	if err != nil && !matchesAwsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+		return err
+	}
+	return nil
+}
+
+func hasTag(tags []*iam.Tag, key string) bool {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"strings"
+	"testing"
+)
+
+func TestConnectorRoleTagKey(t *testing.T) {
+	long := strings.Repeat("c", 100)
+	tests := map[string]struct {
+		name   string
+		region string
+		prefix string
+	}{
+		"short name": {
+			name:   "cluster",
+			region: "us-east-1",
+			prefix: "awsqs.eks/us-east-1/cluster",
+		},
+		"long name": {
+			name:   long,
+			region: "ap-southeast-4",
+			prefix: "awsqs.eks/ap-southeast-4/" + long,
+		},
+		"name over the key limit": {
+			name:   long,
+			region: "us-gov-west-1-long",
+			prefix: "awsqs.eks/us-gov-west-1-long/",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			key := *connectorRoleTagKey(&Model{Name: aws.String(tc.name)}, tc.region)
+			if len(key) > maxTagKeyLength || !strings.HasPrefix(key, tc.prefix) {
+				t.Errorf("expected a key of at most %v characters starting with %v, got %v", maxTagKeyLength, tc.prefix, key)
+			}
+			other := *connectorRoleTagKey(&Model{Name: aws.String(tc.name + "x")}, tc.region)
+			if other == key {
+				t.Errorf("expected clusters of different names to have different keys, got %v", key)
+			}
+		})
+	}
+}
+
+type mockConnectorRoleClient struct {
+	iamiface.IAMAPI
+	tags    []*iam.Tag
+	exists  bool
+	deleted bool
+}
+
+func (m *mockConnectorRoleClient) GetRole(input *iam.GetRoleInput) (*iam.GetRoleOutput, error) {
+	if !m.exists {
+		return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "role not found", nil)
+	}
+	return &iam.GetRoleOutput{Role: &iam.Role{Arn: aws.String("arn:aws:iam::123456789012:role/" + *input.RoleName), Tags: m.tags}}, nil
+}
+
+func (m *mockConnectorRoleClient) CreateRole(input *iam.CreateRoleInput) (*iam.CreateRoleOutput, error) {
+	m.exists = true
+	m.tags = input.Tags
+	return &iam.CreateRoleOutput{Role: &iam.Role{Arn: aws.String("arn:aws:iam::123456789012:role/" + *input.RoleName)}}, nil
+}
+
+func (m *mockConnectorRoleClient) TagRole(input *iam.TagRoleInput) (*iam.TagRoleOutput, error) {
+	m.tags = append(m.tags, input.Tags...)
+	return &iam.TagRoleOutput{}, nil
+}
+
+func (m *mockConnectorRoleClient) UntagRole(input *iam.UntagRoleInput) (*iam.UntagRoleOutput, error) {
+	var tags []*iam.Tag
+	for _, tag := range m.tags {
+		if *tag.Key != *input.TagKeys[0] {
+			tags = append(tags, tag)
+		}
+	}
+	m.tags = tags
+	return &iam.UntagRoleOutput{}, nil
+}
+
+func (m *mockConnectorRoleClient) ListRoleTags(*iam.ListRoleTagsInput) (*iam.ListRoleTagsOutput, error) {
+	return &iam.ListRoleTagsOutput{Tags: m.tags}, nil
+}
+
+func (m *mockConnectorRoleClient) PutRolePolicy(*iam.PutRolePolicyInput) (*iam.PutRolePolicyOutput, error) {
+	return &iam.PutRolePolicyOutput{}, nil
+}
+
+func (m *mockConnectorRoleClient) DeleteRolePolicy(*iam.DeleteRolePolicyInput) (*iam.DeleteRolePolicyOutput, error) {
+	return &iam.DeleteRolePolicyOutput{}, nil
+}
+
+func (m *mockConnectorRoleClient) DeleteRole(*iam.DeleteRoleInput) (*iam.DeleteRoleOutput, error) {
+	m.deleted = true
+	return &iam.DeleteRoleOutput{}, nil
+}
+
+func TestPutConnectorRole(t *testing.T) {
+	managed := &iam.Tag{Key: aws.String(connectorRoleManagedTag), Value: aws.String("true")}
+	tests := map[string]struct {
+		exists  bool
+		tags    []*iam.Tag
+		invalid bool
+	}{
+		"created": {},
+		"referenced by another cluster": {
+			exists: true,
+			tags:   []*iam.Tag{managed, {Key: aws.String("awsqs.eks/us-west-2/cluster"), Value: aws.String("owned")}},
+		},
+		"not created by the resource type": {
+			exists:  true,
+			tags:    []*iam.Tag{{Key: aws.String("team"), Value: aws.String("platform")}},
+			invalid: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockConnectorRoleClient{exists: tc.exists, tags: tc.tags}
+			err := putConnectorRole(svc, testModel("1.23"), "us-east-1")
+			if tc.invalid {
+				if !matchesAwsErrorCode(err, eks.ErrCodeInvalidParameterException) || hasTag(svc.tags, "awsqs.eks/us-east-1/cluster") {
+					t.Errorf("expected an invalid request error without tagging, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !hasTag(svc.tags, connectorRoleManagedTag) || !hasTag(svc.tags, "awsqs.eks/us-east-1/cluster") {
+				t.Errorf("expected the role to be managed and referenced by the cluster, got %v", svc.tags)
+			}
+		})
+	}
+}
+
+func TestReleaseConnectorRole(t *testing.T) {
+	managed := &iam.Tag{Key: aws.String(connectorRoleManagedTag), Value: aws.String("true")}
+	reference := &iam.Tag{Key: aws.String("awsqs.eks/us-east-1/cluster"), Value: aws.String("owned")}
+	tests := map[string]struct {
+		tags    []*iam.Tag
+		deleted bool
+	}{
+		"last reference": {
+			tags:    []*iam.Tag{managed, reference},
+			deleted: true,
+		},
+		"referenced by another cluster": {
+			tags: []*iam.Tag{managed, reference, {Key: aws.String("awsqs.eks/us-west-2/cluster"), Value: aws.String("owned")}},
+		},
+		"not created by the resource type": {
+			tags: []*iam.Tag{reference},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockConnectorRoleClient{exists: true, tags: tc.tags}
+			if err := releaseConnectorRole(svc, testModel("1.23"), "us-east-1"); err != nil {
+				t.Fatal(err)
+			}
+			if hasTag(svc.tags, *reference.Key) {
+				t.Error("expected the reference of the cluster to be removed")
+			}
+			if svc.deleted != tc.deleted {
+				t.Errorf("expected deleted to be %v, got %v", tc.deleted, svc.deleted)
+			}
+		})
+	}
+}
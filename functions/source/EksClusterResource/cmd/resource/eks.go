@@ -1,21 +1,26 @@
 package resource
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/eks"
 	"github.com/aws/aws-sdk-go/service/eks/eksiface"
 	"github.com/jinzhu/copier"
-	"math/rand"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
-	"time"
 )
 
 const (
-	generatedClusterNameSuffixLength = 8
-	generatedClusterNamePrefix       = "EKS-"
+	generatedClusterNameSuffixLength    = 8
+	generatedClusterNamePrefix          = "EKS-"
+	generatedClusterNameLogicalIdLength = 40
 )
 
 var loggingTypes = []string{"api", "audit", "authenticator", "controllerManager", "scheduler"}
@@ -33,12 +38,19 @@ func describeClusterToModel(cluster eks.Cluster, model *Model) {
 	}
 	model.KubernetesNetworkConfig = &KubernetesNetworkConfig{
 		ServiceIpv4Cidr: cluster.KubernetesNetworkConfig.ServiceIpv4Cidr,
+		IpFamily:        cluster.KubernetesNetworkConfig.IpFamily,
+		ServiceIpv6Cidr: cluster.KubernetesNetworkConfig.ServiceIpv6Cidr,
 	}
+	if cluster.AccessConfig != nil {
+		model.AuthenticationMode = cluster.AccessConfig.AuthenticationMode
+	}
+	model.EnabledClusterLoggingTypes = nil
 	for _, l := range cluster.Logging.ClusterLogging {
 		if *l.Enabled {
 			model.EnabledClusterLoggingTypes = aws.StringValueSlice(l.Types)
 		}
 	}
+	model.EncryptionConfig = nil
 	if cluster.EncryptionConfig != nil {
 		var encryptionConfigs []EncryptionConfigEntry
 		for _, e := range cluster.EncryptionConfig {
@@ -48,6 +60,7 @@ func describeClusterToModel(cluster eks.Cluster, model *Model) {
 					KeyArn: e.Provider.KeyArn,
 				},
 			})
+			model.EncryptionConfigKeyArn = e.Provider.KeyArn
 		}
 		model.EncryptionConfig = encryptionConfigs
 	}
@@ -60,41 +73,57 @@ func describeClusterToModel(cluster eks.Cluster, model *Model) {
 			model.OIDCIssuerURL = cluster.Identity.Oidc.Issuer
 		}
 	}
-	if cluster.Tags != nil && len(cluster.Tags) > 0 {
-		for key, value := range cluster.Tags {
-			model.Tags = append(model.Tags, Tags{
-				Key:   &key,
-				Value: value,
-			})
+	model.Tags = nil
+	for key, value := range cluster.Tags {
+		if strings.HasPrefix(key, "aws:") {
+			continue
 		}
+		model.Tags = append(model.Tags, Tags{
+			Key:   aws.String(key),
+			Value: value,
+		})
 	}
+	sort.Slice(model.Tags, func(i, j int) bool { return *model.Tags[i].Key < *model.Tags[j].Key })
 	if slicesEqual(model.ResourcesVpcConfig.PublicAccessCidrs, []string{"0.0.0.0/0"}) {
 		model.ResourcesVpcConfig.PublicAccessCidrs = nil
 	}
 }
 
+// bootstrapsPrivately reports whether the cluster is created with only its private endpoint, rather than with a
+// public endpoint that is disabled once the aws-auth ConfigMap is in place. The bootstrap then goes through the VPC
+// connector function.
+func bootstrapsPrivately(model *Model) bool {
+	return model.PrivateBootstrap != nil && *model.PrivateBootstrap
+}
+
 func makeCreateClusterInput(model *Model) *eks.CreateClusterInput {
 	var cidr *string
+	var ipFamily *string
 	if model.KubernetesNetworkConfig == nil {
 		cidr = nil
 	} else {
 		cidr = model.KubernetesNetworkConfig.ServiceIpv4Cidr
+		ipFamily = model.KubernetesNetworkConfig.IpFamily
 	}
 	input := &eks.CreateClusterInput{
 		Name: model.Name,
 		ResourcesVpcConfig: &eks.VpcConfigRequest{
 			SubnetIds:             aws.StringSlice(model.ResourcesVpcConfig.SubnetIds),
-			EndpointPublicAccess:  aws.Bool(true),
+			EndpointPublicAccess:  aws.Bool(!bootstrapsPrivately(model)),
 			EndpointPrivateAccess: model.ResourcesVpcConfig.EndpointPrivateAccess,
 		},
 		KubernetesNetworkConfig: &eks.KubernetesNetworkConfigRequest{
 			ServiceIpv4Cidr: cidr,
+			IpFamily:        ipFamily,
 		},
 		Logging:          createLogging(model),
 		RoleArn:          model.RoleArn,
 		Version:          model.Version,
 		EncryptionConfig: createEncryptionConfig(model),
 	}
+	if model.AuthenticationMode != nil {
+		input.AccessConfig = &eks.CreateAccessConfigRequest{AuthenticationMode: model.AuthenticationMode}
+	}
 	if model.ResourcesVpcConfig.SecurityGroupIds != nil {
 		input.ResourcesVpcConfig.SecurityGroupIds = aws.StringSlice(model.ResourcesVpcConfig.SecurityGroupIds)
 	}
@@ -118,7 +147,7 @@ func createEncryptionConfig(model *Model) []*eks.EncryptionConfig {
 	return configs
 }
 
-func updateVpcConfig(svc eksiface.EKSAPI, model *Model) error {
+func updateVpcConfig(svc eksiface.EKSAPI, model *Model) (*string, error) {
 	input := &eks.UpdateClusterConfigInput{
 		Name: model.Name,
 		ResourcesVpcConfig: &eks.VpcConfigRequest{
@@ -129,13 +158,38 @@ func updateVpcConfig(svc eksiface.EKSAPI, model *Model) error {
 	if model.ResourcesVpcConfig.PublicAccessCidrs != nil {
 		input.ResourcesVpcConfig.PublicAccessCidrs = aws.StringSlice(model.ResourcesVpcConfig.PublicAccessCidrs)
 	}
-	_, err := svc.UpdateClusterConfig(input)
+	response, err := svc.UpdateClusterConfig(input)
 	if err != nil {
 		if strings.Contains(err.Error(), "Cluster is already at the desired configuration") {
-			return nil
+			return nil, nil
 		}
+		return nil, err
 	}
-	return err
+	return response.Update.Id, nil
+}
+
+// updateSubnetsConfig applies subnet and security group changes. EKS treats these as a separate update type from
+// endpoint access changes, so they are sent on their own.
+func updateSubnetsConfig(svc eksiface.EKSAPI, model *Model) (*string, error) {
+	securityGroupIds := model.ResourcesVpcConfig.SecurityGroupIds
+	if securityGroupIds == nil {
+		securityGroupIds = []string{}
+	}
+	input := &eks.UpdateClusterConfigInput{
+		Name: model.Name,
+		ResourcesVpcConfig: &eks.VpcConfigRequest{
+			SubnetIds:        aws.StringSlice(model.ResourcesVpcConfig.SubnetIds),
+			SecurityGroupIds: aws.StringSlice(securityGroupIds),
+		},
+	}
+	response, err := svc.UpdateClusterConfig(input)
+	if err != nil {
+		if strings.Contains(err.Error(), "Cluster is already at the desired configuration") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return response.Update.Id, nil
 }
 
 func createLogging(model *Model) *eks.Logging {
@@ -160,10 +214,13 @@ func createLogging(model *Model) *eks.Logging {
 	return &eks.Logging{ClusterLogging: logSetups}
 }
 
-func updateLoggingConfig(svc eksiface.EKSAPI, model *Model) error {
+func updateLoggingConfig(svc eksiface.EKSAPI, model *Model) (*string, error) {
 	input := &eks.UpdateClusterConfigInput{Name: model.Name, Logging: createLogging(model)}
-	_, err := svc.UpdateClusterConfig(input)
-	return err
+	response, err := svc.UpdateClusterConfig(input)
+	if err != nil {
+		return nil, err
+	}
+	return response.Update.Id, nil
 }
 
 func getDisabledLoggingTypes(enabled []string) (disabled []string) {
@@ -188,31 +245,89 @@ func getDisabledLoggingTypes(enabled []string) (disabled []string) {
 	return disabled
 }
 
-func updateVersionConfig(svc eksiface.EKSAPI, model *Model) error {
+func updateVersionConfig(svc eksiface.EKSAPI, model *Model, version string) (*string, error) {
 	input := &eks.UpdateClusterVersionInput{
 		Name:    model.Name,
-		Version: model.Version,
+		Version: aws.String(version),
 	}
-	// TODO: version rollback is problematic, see https://github.com/aws/containers-roadmap/issues/497
-	_, err := svc.UpdateClusterVersion(input)
-	return err
+	response, err := svc.UpdateClusterVersion(input)
+	if err != nil {
+		return nil, err
+	}
+	return response.Update.Id, nil
+}
+
+// planVersionUpgrade returns the minor versions to step through to get from the current to the desired version, as
+// EKS only upgrades one minor version at a time. Downgrades aren't supported by EKS, see
+// https://github.com/aws/containers-roadmap/issues/497, so they are rejected as invalid requests.
+func planVersionUpgrade(current string, desired string) ([]string, error) {
+	currentMajor, currentMinor, err := parseVersion(current)
+	if err != nil {
+		return nil, err
+	}
+	desiredMajor, desiredMinor, err := parseVersion(desired)
+	if err != nil {
+		return nil, invalidRequestError(err.Error())
+	}
+	if desiredMajor < currentMajor || (desiredMajor == currentMajor && desiredMinor < currentMinor) {
+		return nil, invalidRequestError(fmt.Sprintf("cannot downgrade Kubernetes version from %v to %v", current, desired))
+	}
+	if desiredMajor != currentMajor {
+		return nil, invalidRequestError(fmt.Sprintf("cannot upgrade Kubernetes version from %v to %v", current, desired))
+	}
+	var plan []string
+	for minor := currentMinor + 1; minor <= desiredMinor; minor++ {
+		plan = append(plan, fmt.Sprintf("%d.%d", currentMajor, minor))
+	}
+	return plan, nil
 }
 
 func updateTags(svc eksiface.EKSAPI, current *Model, desired *Model) error {
-	if desired.Tags != nil && len(desired.Tags) > 0 {
-		input := &eks.TagResourceInput{
-			ResourceArn: current.Arn,
-			Tags:        make(map[string]*string),
+	added, removed := diffTags(tagsToMap(current.Tags), tagsToMap(desired.Tags))
+	if len(removed) > 0 {
+		_, err := svc.UntagResource(&eks.UntagResourceInput{ResourceArn: current.Arn, TagKeys: removed})
+		if err != nil {
+			return err
 		}
-		for _, tag := range desired.Tags {
-			input.Tags[*tag.Key] = tag.Value
+	}
+	if len(added) > 0 {
+		_, err := svc.TagResource(&eks.TagResourceInput{ResourceArn: current.Arn, Tags: added})
+		if err != nil {
+			return err
 		}
-		_, err := svc.TagResource(input)
-		return err
 	}
 	return nil
 }
 
+func tagsToMap(tags []Tags) map[string]string {
+	tagMap := make(map[string]string)
+	for _, tag := range tags {
+		tagMap[*tag.Key] = aws.StringValue(tag.Value)
+	}
+	return tagMap
+}
+
+// diffTags returns the tags to add or change and the keys to remove to get from the current to the desired tags.
+// Keys with the reserved aws: prefix can't be modified and are left alone.
+func diffTags(current map[string]string, desired map[string]string) (map[string]*string, []*string) {
+	var added map[string]*string
+	var removed []*string
+	for key, value := range desired {
+		if currentValue, ok := current[key]; !ok || currentValue != value {
+			if added == nil {
+				added = make(map[string]*string)
+			}
+			added[key] = aws.String(value)
+		}
+	}
+	for key := range current {
+		if _, ok := desired[key]; !ok && !strings.HasPrefix(key, "aws:") {
+			removed = append(removed, aws.String(key))
+		}
+	}
+	return added, removed
+}
+
 func versionChanged(current Model, desired Model) bool {
 	if desired.Version == nil {
 		return false
@@ -247,6 +362,22 @@ func vpcChanged(current Model, desired Model) bool {
 	return false
 }
 
+func subnetsChanged(current Model, desired Model) bool {
+	if desired.ResourcesVpcConfig == nil {
+		return false
+	}
+	currentVpc := current.ResourcesVpcConfig
+	desiredVpc := desired.ResourcesVpcConfig
+	// slicesEqual sorts its arguments, so compare copies to keep the order of the desired model
+	if desiredVpc.SubnetIds != nil && !slicesEqual(currentVpc.SubnetIds, append([]string(nil), desiredVpc.SubnetIds...)) {
+		return true
+	}
+	if len(currentVpc.SecurityGroupIds) == 0 && len(desiredVpc.SecurityGroupIds) == 0 {
+		return false
+	}
+	return !slicesEqual(currentVpc.SecurityGroupIds, append([]string(nil), desiredVpc.SecurityGroupIds...))
+}
+
 func loggingChanged(current Model, desired Model) bool {
 	if !slicesEqual(desired.EnabledClusterLoggingTypes, current.EnabledClusterLoggingTypes) {
 		return true
@@ -254,8 +385,60 @@ func loggingChanged(current Model, desired Model) bool {
 	return false
 }
 
+// encryptionChanged reports whether envelope encryption needs to be enabled on a cluster created without it.
+func encryptionChanged(current Model, desired Model) bool {
+	return len(current.EncryptionConfig) == 0 && len(desired.EncryptionConfig) > 0
+}
+
+// validateEncryptionChange rejects changes EKS can't make: once enabled, envelope encryption can't be disabled and
+// neither its key nor the resources it encrypts can be changed.
+func validateEncryptionChange(current Model, desired Model) error {
+	if len(current.EncryptionConfig) == 0 {
+		return nil
+	}
+	if len(desired.EncryptionConfig) == 0 {
+		return invalidRequestError("EncryptionConfig cannot be removed once encryption is enabled on the cluster")
+	}
+	currentKey := current.EncryptionConfig[0].Provider.KeyArn
+	for _, c := range desired.EncryptionConfig {
+		if c.Provider == nil || aws.StringValue(c.Provider.KeyArn) != aws.StringValue(currentKey) {
+			return invalidRequestError(fmt.Sprintf("the encryption key of the cluster cannot be changed from %v", aws.StringValue(currentKey)))
+		}
+	}
+	currentResources := encryptedResources(current.EncryptionConfig)
+	if !slicesEqual(append([]string(nil), currentResources...), encryptedResources(desired.EncryptionConfig)) {
+		return invalidRequestError(fmt.Sprintf("the encrypted resources of the cluster cannot be changed from %v", strings.Join(currentResources, ", ")))
+	}
+	return nil
+}
+
+// encryptedResources returns the resources the encryption configuration applies to, without duplicates.
+func encryptedResources(configs []EncryptionConfigEntry) []string {
+	var resources []string
+	for _, c := range configs {
+		for _, r := range c.Resources {
+			if !containsString(resources, r) {
+				resources = append(resources, r)
+			}
+		}
+	}
+	return resources
+}
+
+func associateEncryptionConfig(svc eksiface.EKSAPI, model *Model) (*string, error) {
+	response, err := svc.AssociateEncryptionConfig(&eks.AssociateEncryptionConfigInput{
+		ClusterName:      model.Name,
+		EncryptionConfig: createEncryptionConfig(model),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response.Update.Id, nil
+}
+
 func tagsChanged(current Model, desired Model) bool {
-	return desired.Tags != nil && len(desired.Tags) > 0
+	added, removed := diffTags(tagsToMap(current.Tags), tagsToMap(desired.Tags))
+	return len(added) > 0 || len(removed) > 0
 }
 
 func slicesEqual(s1 []string, s2 []string) bool {
@@ -265,15 +448,73 @@ func slicesEqual(s1 []string, s2 []string) bool {
 	return reflect.DeepEqual(s1, s2)
 }
 
-func generateClusterName() *string {
-	rand.Seed(time.Now().UnixNano())
-	letters := []rune("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ")
-	b := make([]rune, generatedClusterNameSuffixLength)
-	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// parseVersion splits a Kubernetes version such as "1.21" into its major and minor components.
+func parseVersion(version string) (int, int, error) {
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("invalid Kubernetes version %q", version)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Kubernetes version %q", version)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Kubernetes version %q", version)
+	}
+	return major, minor, nil
+}
+
+// createRequestSeed identifies the creation of the resource across retries of the handler. Besides the stack and the
+// logical ID it covers the properties that require replacement, so that a replacement cluster, which is created
+// while the one it replaces still exists, gets a different name and request token, and the create ID, so that a
+// cluster created again after an earlier one was deleted does too.
+func createRequestSeed(model *Model, stackId string, logicalId string, createId string) string {
+	replacing, _ := json.Marshal(struct {
+		Name                    *string
+		RoleArn                 *string
+		KubernetesNetworkConfig *KubernetesNetworkConfig
+	}{model.Name, model.RoleArn, model.KubernetesNetworkConfig})
+	return stackId + "/" + logicalId + "/" + createId + "/" + string(replacing)
+}
+
+// newCreateId returns a random ID for a create request, which the handler keeps in the callback context.
+func newCreateId() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
 	}
-	generated := generatedClusterNamePrefix + string(b)
-	return &generated
+	return hex.EncodeToString(id), nil
+}
+
+// generateClusterName derives the name of a cluster that has no Name from the logical ID and a hash of the create
+// request, so that a retried create targets the same cluster.
+func generateClusterName(logicalId string, seed string) *string {
+	sum := sha256.Sum256([]byte(seed))
+	if len(logicalId) > generatedClusterNameLogicalIdLength {
+		logicalId = logicalId[:generatedClusterNameLogicalIdLength]
+	}
+	if logicalId != "" {
+		logicalId += "-"
+	}
+	suffix := strings.ToUpper(hex.EncodeToString(sum[:]))[:generatedClusterNameSuffixLength]
+	return aws.String(generatedClusterNamePrefix + logicalId + suffix)
+}
+
+// clientRequestToken returns the idempotency token of the CreateCluster call, which makes EKS return the cluster
+// created by an earlier attempt instead of failing.
+func clientRequestToken(seed string) *string {
+	sum := sha256.Sum256([]byte("ClientRequestToken/" + seed))
+	return aws.String(hex.EncodeToString(sum[:16]))
 }
 
 func matchesAwsErrorCode(err error, code string) bool {
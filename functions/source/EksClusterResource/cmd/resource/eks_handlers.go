@@ -1,19 +1,25 @@
 package resource
 
 import (
+	"fmt"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/eks"
 	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"log"
 	"strings"
 )
 
-func createCluster(svc eksiface.EKSAPI, model *Model, reInvoke bool) (OperationComplete, error) {
+func createCluster(svc eksiface.EKSAPI, model *Model, token *string, reInvoke bool) (OperationComplete, error) {
 	if reInvoke {
 		_, complete, _, err := stabilize(svc, model, "ACTIVE")
 		return complete, err
 	}
 	input := makeCreateClusterInput(model)
+	input.ClientRequestToken = token
 	_, err := svc.CreateCluster(input)
 	if err != nil {
 		return Complete, err
@@ -21,12 +27,57 @@ func createCluster(svc eksiface.EKSAPI, model *Model, reInvoke bool) (OperationC
 	return InProgress, nil
 }
 
-func readCluster(svc eksiface.EKSAPI, model *Model) handler.ProgressEvent {
+func adoptsExistingCluster(model *Model) bool {
+	return model.AdoptExisting != nil && *model.AdoptExisting
+}
+
+// adoptCluster takes over an existing cluster with the model's name instead of creating it. To guard against taking
+// over an unrelated cluster, the model must declare tags and the cluster must carry all of them with the same values.
+func adoptCluster(svc eksiface.EKSAPI, model *Model) error {
+	response, err := svc.DescribeCluster(&eks.DescribeClusterInput{Name: model.Name})
+	if err != nil {
+		return err
+	}
+	if len(model.Tags) == 0 {
+		return awserr.New(eks.ErrCodeResourceInUseException,
+			fmt.Sprintf("cluster %v already exists, Tags are required to adopt it", *model.Name), nil)
+	}
+	for _, tag := range model.Tags {
+		value, ok := response.Cluster.Tags[*tag.Key]
+		if !ok || aws.StringValue(value) != aws.StringValue(tag.Value) {
+			return awserr.New(eks.ErrCodeResourceInUseException,
+				fmt.Sprintf("cluster %v already exists and its tag %v does not match", *model.Name, *tag.Key), nil)
+		}
+	}
+	log.Printf("Adopting existing cluster %v...\n", *model.Name)
+	return nil
+}
+
+func readCluster(sess *session.Session, svc eksiface.EKSAPI, model *Model) handler.ProgressEvent {
 	response, err := svc.DescribeCluster(&eks.DescribeClusterInput{Name: model.Name})
 	if err != nil {
 		return errorEvent(model, err)
 	}
 	describeClusterToModel(*response.Cluster, model)
+	if createsOIDCProvider(model) {
+		model.OIDCProviderArn = oidcProviderArn(model.Arn, model.OIDCIssuerURL)
+	}
+	err = readNodeGroups(svc, model)
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	if usesConfigMap(model) {
+		err = readIamAuth(sess, svc, model)
+		if err != nil {
+			return errorEvent(model, err)
+		}
+	}
+	if exportsKubeConfig(model) {
+		err = readKubeConfigSecret(secretsmanager.New(sess), model)
+		if err != nil {
+			return errorEvent(model, err)
+		}
+	}
 	return successEvent(model)
 }
 
@@ -37,68 +88,164 @@ func updateInProgress(err error) bool {
 	return false
 }
 
-func updateCluster(svc eksiface.EKSAPI, desiredModel *Model) (OperationComplete, error) {
-	currentModel, complete, _, err := stabilize(svc, desiredModel, "ACTIVE")
+// updateError is an EKS cluster update that failed or was cancelled, carrying the errors EKS reported for it.
+type updateError struct {
+	update *eks.Update
+}
+
+func (e updateError) Error() string {
+	message := fmt.Sprintf("cluster update %v (%v) %v", aws.StringValue(e.update.Id), aws.StringValue(e.update.Type),
+		strings.ToLower(aws.StringValue(e.update.Status)))
+	var details []string
+	for _, detail := range e.update.Errors {
+		details = append(details, fmt.Sprintf("%v: %v", aws.StringValue(detail.ErrorCode), aws.StringValue(detail.ErrorMessage)))
+	}
+	if len(details) > 0 {
+		message += ": " + strings.Join(details, "; ")
+	}
+	return message
+}
+
+// waitForUpdate polls the cluster update started by an earlier invocation. Complete is returned once it succeeded, a
+// failed or cancelled update is returned as an updateError.
+func waitForUpdate(svc eksiface.EKSAPI, clusterName *string, updateId *string) (OperationComplete, error) {
+	response, err := svc.DescribeUpdate(&eks.DescribeUpdateInput{Name: clusterName, UpdateId: updateId})
 	if err != nil {
 		return Complete, err
 	}
-	if !complete {
-		return InProgress, err
+	switch aws.StringValue(response.Update.Status) {
+	case eks.UpdateStatusSuccessful:
+		return Complete, nil
+	case eks.UpdateStatusFailed, eks.UpdateStatusCancelled:
+		return Complete, updateError{update: response.Update}
 	}
-	if vpcChanged(*currentModel, *desiredModel) {
-		log.Println("Updating VPC config...")
-		err := updateVpcConfig(svc, desiredModel)
+	log.Printf("Waiting for cluster update %v...\n", *updateId)
+	return InProgress, nil
+}
+
+// versionUpgrade tracks a multi-step version upgrade across invocations: the planned chain of versions, the 1-based
+// hop in progress, the ID of the EKS update for that hop and the readiness check failures that were accepted as
+// warnings for it.
+type versionUpgrade struct {
+	Plan     []string
+	Hop      int
+	UpdateId *string
+	Warnings []string
+}
+
+// upgradeClusterVersion moves the cluster one minor version closer to the desired version per call, running the
+// readiness checks before each hop. Complete is returned once the desired version is reached.
+func upgradeClusterVersion(sess *session.Session, svc eksiface.EKSAPI, desiredModel *Model, upgrade *versionUpgrade) (OperationComplete, error) {
+	if upgrade.UpdateId != nil {
+		complete, err := waitForUpdate(svc, desiredModel.Name, upgrade.UpdateId)
 		if err != nil {
-			if updateInProgress(err) {
-				return InProgress, nil
-			}
 			return Complete, err
 		}
+		if !complete {
+			return InProgress, nil
+		}
+		upgrade.UpdateId = nil
+	}
+	currentModel, complete, _, err := stabilize(svc, desiredModel, "ACTIVE")
+	if err != nil {
+		return Complete, err
+	}
+	if !versionChanged(*currentModel, *desiredModel) {
+		return Complete, nil
+	}
+	remaining, err := planVersionUpgrade(*currentModel.Version, *desiredModel.Version)
+	if err != nil || len(remaining) == 0 {
+		return Complete, err
+	}
+	plan := upgrade.Plan
+	if len(remaining) > len(plan) || plan[len(plan)-1] != remaining[len(remaining)-1] {
+		upgrade.Plan = remaining
+	}
+	upgrade.Hop = len(upgrade.Plan) - len(remaining) + 1
+	if !complete {
 		return InProgress, nil
 	}
-	if loggingChanged(*currentModel, *desiredModel) {
-		log.Println("Updating logging config...")
-		err := updateLoggingConfig(svc, desiredModel)
+	failures, err := checkUpgradeReadiness(sess, svc, desiredModel, remaining[0])
+	if err != nil {
+		return Complete, err
+	}
+	if len(failures) > 0 && !warnsOnReadinessFailures(desiredModel) {
+		return Complete, invalidRequestError(fmt.Sprintf("cluster is not ready to be upgraded to Kubernetes %v: %v", remaining[0], strings.Join(failures, "; ")))
+	}
+	for _, failure := range failures {
+		log.Printf("WARNING: %v\n", failure)
+	}
+	upgrade.Warnings = failures
+	log.Printf("Updating kubernetes version to %v (%v of %v)...\n", remaining[0], upgrade.Hop, len(upgrade.Plan))
+	upgrade.UpdateId, err = updateVersionConfig(svc, desiredModel, remaining[0])
+	if err != nil && !updateInProgress(err) {
+		return Complete, err
+	}
+	return InProgress, nil
+}
+
+// updateCluster applies one pending configuration change per call. updateId is the cluster update started by an
+// earlier invocation, which is waited for first; the ID of the update started by this call, or of the one still being
+// waited for, is returned so it can be kept in the callback context.
+func updateCluster(svc eksiface.EKSAPI, desiredModel *Model, updateId *string) (OperationComplete, *string, error) {
+	if updateId != nil {
+		complete, err := waitForUpdate(svc, desiredModel.Name, updateId)
 		if err != nil {
-			if updateInProgress(err) {
-				return InProgress, nil
-			}
-			return Complete, err
+			return Complete, nil, err
+		}
+		if !complete {
+			return InProgress, updateId, nil
 		}
-		return InProgress, nil
 	}
-	if versionChanged(*currentModel, *desiredModel) {
-		log.Println("Updating kubernetes version...")
-		err := updateVersionConfig(svc, desiredModel)
-		if err != nil {
-			if updateInProgress(err) {
-				return InProgress, nil
-			}
-			return Complete, err
+	currentModel, complete, _, err := stabilize(svc, desiredModel, "ACTIVE")
+	if err != nil {
+		return Complete, nil, err
+	}
+	if !complete {
+		return InProgress, nil, err
+	}
+	if err := validateEncryptionChange(*currentModel, *desiredModel); err != nil {
+		return Complete, nil, err
+	}
+	var update func(eksiface.EKSAPI, *Model) (*string, error)
+	switch {
+	case subnetsChanged(*currentModel, *desiredModel):
+		log.Println("Updating subnets and security groups...")
+		update = updateSubnetsConfig
+	case vpcChanged(*currentModel, *desiredModel):
+		log.Println("Updating VPC config...")
+		update = updateVpcConfig
+	case loggingChanged(*currentModel, *desiredModel):
+		log.Println("Updating logging config...")
+		update = updateLoggingConfig
+	case encryptionChanged(*currentModel, *desiredModel):
+		log.Println("Associating encryption config...")
+		update = associateEncryptionConfig
+	case accessConfigChanged(*currentModel, *desiredModel):
+		log.Println("Updating authentication mode...")
+		update = updateAccessConfig
+	}
+	if update != nil {
+		updateId, err = update(svc, desiredModel)
+		if err != nil && !updateInProgress(err) {
+			return Complete, nil, err
 		}
-		return InProgress, nil
+		return InProgress, updateId, nil
 	}
 	if tagsChanged(*currentModel, *desiredModel) {
 		log.Println("Updating kubernetes tags...")
 		err = updateTags(svc, currentModel, desiredModel)
 		if err != nil {
 			if updateInProgress(err) {
-				return InProgress, nil
+				return InProgress, nil, nil
 			}
-			return Complete, err
+			return Complete, nil, err
 		}
 	}
-	return Complete, nil
+	return Complete, nil, nil
 }
 
-func deleteCluster(svc eksiface.EKSAPI, model *Model, callback bool) handler.ProgressEvent {
-	if !callback {
-		input := &eks.DescribeClusterInput{Name: model.Name}
-		_, err := svc.DescribeCluster(input)
-		if err != nil {
-			return errorEvent(model, err)
-		}
-	}
+func deleteCluster(svc eksiface.EKSAPI, model *Model) handler.ProgressEvent {
 	_, complete, status, err := stabilize(svc, model, "DELETED")
 	if complete {
 		return successEvent(nil)
@@ -118,8 +265,12 @@ func deleteCluster(svc eksiface.EKSAPI, model *Model, callback bool) handler.Pro
 	return inProgressEvent(model, DeleteClusterStage)
 }
 
-func listClusters(svc eksiface.EKSAPI) handler.ProgressEvent {
-	response, err := svc.ListClusters(&eks.ListClustersInput{})
+func listClusters(svc eksiface.EKSAPI, nextToken string) handler.ProgressEvent {
+	input := &eks.ListClustersInput{}
+	if nextToken != "" {
+		input.NextToken = aws.String(nextToken)
+	}
+	response, err := svc.ListClusters(input)
 	if err != nil {
 		return errorEvent(nil, err)
 	}
@@ -130,5 +281,6 @@ func listClusters(svc eksiface.EKSAPI) handler.ProgressEvent {
 	return handler.ProgressEvent{
 		ResourceModels:  models,
 		OperationStatus: handler.Success,
+		NextToken:       aws.StringValue(response.NextToken),
 	}
 }
@@ -0,0 +1,396 @@
+package resource
+
+import (
+	"encoding/json"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type mockEKSClient struct {
+	eksiface.EKSAPI
+	cluster        *eks.Cluster
+	updateStatus   string
+	versionUpdates []string
+	configUpdates  int
+	insights       []*eks.InsightSummary
+}
+
+func (m *mockEKSClient) DescribeCluster(*eks.DescribeClusterInput) (*eks.DescribeClusterOutput, error) {
+	return &eks.DescribeClusterOutput{Cluster: m.cluster}, nil
+}
+
+func (m *mockEKSClient) DescribeUpdate(input *eks.DescribeUpdateInput) (*eks.DescribeUpdateOutput, error) {
+	return &eks.DescribeUpdateOutput{Update: &eks.Update{Id: input.UpdateId, Status: aws.String(m.updateStatus)}}, nil
+}
+
+func (m *mockEKSClient) UpdateClusterVersion(input *eks.UpdateClusterVersionInput) (*eks.UpdateClusterVersionOutput, error) {
+	m.versionUpdates = append(m.versionUpdates, *input.Version)
+	return &eks.UpdateClusterVersionOutput{Update: &eks.Update{Id: aws.String("update-" + *input.Version)}}, nil
+}
+
+func (m *mockEKSClient) UpdateClusterConfig(*eks.UpdateClusterConfigInput) (*eks.UpdateClusterConfigOutput, error) {
+	m.configUpdates++
+	return &eks.UpdateClusterConfigOutput{Update: &eks.Update{Id: aws.String("update-config")}}, nil
+}
+
+func (m *mockEKSClient) ListInsightsPages(_ *eks.ListInsightsInput, fn func(*eks.ListInsightsOutput, bool) bool) error {
+	fn(&eks.ListInsightsOutput{Insights: m.insights}, true)
+	return nil
+}
+
+func (m *mockEKSClient) ListAddonsPages(_ *eks.ListAddonsInput, fn func(*eks.ListAddonsOutput, bool) bool) error {
+	fn(&eks.ListAddonsOutput{}, true)
+	return nil
+}
+
+// testCluster returns a private cluster, so that the upgrade readiness checks don't need to reach the API server.
+func testCluster(status string, version string) *eks.Cluster {
+	return &eks.Cluster{
+		Name:    aws.String("cluster"),
+		Arn:     aws.String("arn:aws:eks:us-east-1:123456789012:cluster/cluster"),
+		Status:  aws.String(status),
+		Version: aws.String(version),
+		ResourcesVpcConfig: &eks.VpcConfigResponse{
+			SubnetIds:             aws.StringSlice([]string{"subnet-1", "subnet-2"}),
+			EndpointPublicAccess:  aws.Bool(false),
+			EndpointPrivateAccess: aws.Bool(true),
+			PublicAccessCidrs:     aws.StringSlice([]string{"0.0.0.0/0"}),
+		},
+		KubernetesNetworkConfig: &eks.KubernetesNetworkConfigResponse{},
+		Logging:                 &eks.Logging{},
+		CertificateAuthority:    &eks.Certificate{},
+	}
+}
+
+func testModel(version string) *Model {
+	return &Model{
+		Name:    aws.String("cluster"),
+		Version: aws.String(version),
+		ResourcesVpcConfig: &ResourcesVpcConfig{
+			SubnetIds:             []string{"subnet-1", "subnet-2"},
+			EndpointPublicAccess:  aws.Bool(false),
+			EndpointPrivateAccess: aws.Bool(true),
+		},
+	}
+}
+
+// roundTrip encodes a callback context the way it is carried between invocations.
+func roundTrip(t *testing.T, context map[string]interface{}) map[string]interface{} {
+	data, err := json.Marshal(context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestUpgradeClusterVersionWaitsForPendingUpdate(t *testing.T) {
+	tests := map[string]struct {
+		context map[string]interface{}
+		message string
+	}{
+		"hop kept in context": {
+			context: map[string]interface{}{"VersionPlan": []string{"1.21", "1.22", "1.23"}, "VersionHop": 2, "UpdateId": "update-2"},
+			message: "Upgrading Kubernetes version to 1.22 (step 2 of 3)\n",
+		},
+		"context without hop": {
+			context: map[string]interface{}{"VersionPlan": []string{"1.21", "1.22", "1.23"}, "UpdateId": "update-2"},
+			message: "Upgrading Kubernetes version to 1.23\n",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			model := &Model{Name: aws.String("cluster"), Version: aws.String("1.23")}
+			upgrade := getVersionUpgrade(roundTrip(t, tc.context))
+			complete, err := upgradeClusterVersion(nil, &mockEKSClient{updateStatus: eks.UpdateStatusInProgress}, model, upgrade)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if complete {
+				t.Fatal("expected the upgrade to be in progress")
+			}
+			event := versionUpgradeEvent(model, upgrade)
+			if event.Message != tc.message {
+				t.Errorf("expected message %q, got %q", tc.message, event.Message)
+			}
+			if next := getVersionUpgrade(roundTrip(t, event.CallbackContext)); next.Hop != upgrade.Hop || aws.StringValue(next.UpdateId) != "update-2" {
+				t.Errorf("expected hop %v and update update-2 to be kept, got %v and %v", upgrade.Hop, next.Hop, aws.StringValue(next.UpdateId))
+			}
+		})
+	}
+}
+
+func TestUpgradeClusterVersionFailedUpdate(t *testing.T) {
+	model := &Model{Name: aws.String("cluster"), Version: aws.String("1.23")}
+	upgrade := &versionUpgrade{Plan: []string{"1.22", "1.23"}, Hop: 1, UpdateId: aws.String("update-1")}
+	_, err := upgradeClusterVersion(nil, &mockEKSClient{updateStatus: eks.UpdateStatusFailed}, model, upgrade)
+	if err == nil || !strings.Contains(err.Error(), "update-1") {
+		t.Errorf("expected the failed update to be reported, got %v", err)
+	}
+}
+
+func TestUpgradeClusterVersion(t *testing.T) {
+	tests := map[string]struct {
+		cluster  *eks.Cluster
+		upgrade  versionUpgrade
+		complete OperationComplete
+		updates  []string
+		expected versionUpgrade
+	}{
+		"at the desired version": {
+			cluster:  testCluster("ACTIVE", "1.23"),
+			complete: Complete,
+		},
+		"starts the first hop": {
+			cluster:  testCluster("ACTIVE", "1.21"),
+			complete: InProgress,
+			updates:  []string{"1.22"},
+			expected: versionUpgrade{Plan: []string{"1.22", "1.23"}, Hop: 1, UpdateId: aws.String("update-1.22")},
+		},
+		"starts the next hop once the previous one succeeded": {
+			cluster:  testCluster("ACTIVE", "1.22"),
+			upgrade:  versionUpgrade{Plan: []string{"1.22", "1.23"}, Hop: 1, UpdateId: aws.String("update-1.22")},
+			complete: InProgress,
+			updates:  []string{"1.23"},
+			expected: versionUpgrade{Plan: []string{"1.22", "1.23"}, Hop: 2, UpdateId: aws.String("update-1.23")},
+		},
+		"waits for the cluster to be active": {
+			cluster:  testCluster("UPDATING", "1.22"),
+			upgrade:  versionUpgrade{Plan: []string{"1.22", "1.23"}, Hop: 1},
+			complete: InProgress,
+			expected: versionUpgrade{Plan: []string{"1.22", "1.23"}, Hop: 2},
+		},
+		"completes after the last hop": {
+			cluster:  testCluster("ACTIVE", "1.23"),
+			upgrade:  versionUpgrade{Plan: []string{"1.22", "1.23"}, Hop: 2, UpdateId: aws.String("update-1.23")},
+			complete: Complete,
+			expected: versionUpgrade{Plan: []string{"1.22", "1.23"}, Hop: 2},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockEKSClient{cluster: tc.cluster, updateStatus: eks.UpdateStatusSuccessful}
+			upgrade := tc.upgrade
+			complete, err := upgradeClusterVersion(nil, svc, testModel("1.23"), &upgrade)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if complete != tc.complete {
+				t.Errorf("expected complete to be %v, got %v", tc.complete, complete)
+			}
+			if !reflect.DeepEqual(svc.versionUpdates, tc.updates) {
+				t.Errorf("expected version updates %v, got %v", tc.updates, svc.versionUpdates)
+			}
+			if !reflect.DeepEqual(upgrade.Plan, tc.expected.Plan) || upgrade.Hop != tc.expected.Hop ||
+				aws.StringValue(upgrade.UpdateId) != aws.StringValue(tc.expected.UpdateId) {
+				t.Errorf("expected %+v, got %+v", tc.expected, upgrade)
+			}
+		})
+	}
+}
+
+func TestUpdateCluster(t *testing.T) {
+	logging := testModel("1.23")
+	logging.EnabledClusterLoggingTypes = []string{"api"}
+	tests := map[string]struct {
+		cluster      *eks.Cluster
+		model        *Model
+		updateId     *string
+		updateStatus string
+		complete     OperationComplete
+		nextUpdateId string
+		updates      int
+		failed       bool
+	}{
+		"waits for the pending update": {
+			cluster:      testCluster("UPDATING", "1.23"),
+			model:        logging,
+			updateId:     aws.String("update-1"),
+			updateStatus: eks.UpdateStatusInProgress,
+			complete:     InProgress,
+			nextUpdateId: "update-1",
+		},
+		"reports the failed update": {
+			cluster:      testCluster("ACTIVE", "1.23"),
+			model:        logging,
+			updateId:     aws.String("update-1"),
+			updateStatus: eks.UpdateStatusFailed,
+			failed:       true,
+		},
+		"starts the next update": {
+			cluster:      testCluster("ACTIVE", "1.23"),
+			model:        logging,
+			updateId:     aws.String("update-1"),
+			updateStatus: eks.UpdateStatusSuccessful,
+			complete:     InProgress,
+			nextUpdateId: "update-config",
+			updates:      1,
+		},
+		"waits for the cluster to be active": {
+			cluster:  testCluster("UPDATING", "1.23"),
+			model:    logging,
+			complete: InProgress,
+		},
+		"nothing to update": {
+			cluster:  testCluster("ACTIVE", "1.23"),
+			model:    testModel("1.23"),
+			complete: Complete,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockEKSClient{cluster: tc.cluster, updateStatus: tc.updateStatus}
+			complete, updateId, err := updateCluster(svc, tc.model, tc.updateId)
+			if tc.failed {
+				if _, ok := err.(updateError); !ok {
+					t.Errorf("expected an update error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if complete != tc.complete {
+				t.Errorf("expected complete to be %v, got %v", tc.complete, complete)
+			}
+			if aws.StringValue(updateId) != tc.nextUpdateId {
+				t.Errorf("expected update %q, got %q", tc.nextUpdateId, aws.StringValue(updateId))
+			}
+			if svc.configUpdates != tc.updates {
+				t.Errorf("expected %v config updates, got %v", tc.updates, svc.configUpdates)
+			}
+			event := updateClusterEvent(tc.model, updateId)
+			context := roundTrip(t, event.CallbackContext)
+			if getStage(context) != UpdateClusterStage || aws.StringValue(getUpdateId(context)) != tc.nextUpdateId {
+				t.Errorf("expected stage %v with update %q, got %v", UpdateClusterStage, tc.nextUpdateId, context)
+			}
+		})
+	}
+}
+
+func TestCreateInitNamesTheCreate(t *testing.T) {
+	tests := map[string]struct {
+		name      *string
+		generated bool
+	}{
+		"given name": {
+			name: aws.String("cluster"),
+		},
+		"generated name": {
+			generated: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := handler.Request{
+				LogicalResourceID: "Cluster",
+				RequestContext:    handler.RequestContext{StackID: "arn:aws:cloudformation:us-east-1:123456789012:stack/stack/0a1b2c3d"},
+			}
+			var names, createIds []string
+			for i := 0; i < 2; i++ {
+				model := testModel("1.23")
+				model.Name = tc.name
+				event := createInit(req, model)
+				if event.OperationStatus != handler.InProgress {
+					t.Fatalf("expected the create to be in progress, got %v: %v", event.OperationStatus, event.Message)
+				}
+				context := roundTrip(t, event.CallbackContext)
+				if getStage(context) != InitStage || getCreateId(context) == nil || getClusterName(context) == nil {
+					t.Fatalf("expected stage %v with a create ID and cluster name, got %v", InitStage, context)
+				}
+				names = append(names, *getClusterName(context))
+				createIds = append(createIds, *getCreateId(context))
+			}
+			if createIds[0] == createIds[1] {
+				t.Errorf("expected each create to get its own ID, got %v twice", createIds[0])
+			}
+			if renamed := names[0] != names[1]; renamed != tc.generated {
+				t.Errorf("expected the name to change between creates to be %v, got %v", tc.generated, names)
+			}
+		})
+	}
+}
+
+func TestAdoptCluster(t *testing.T) {
+	tests := map[string]struct {
+		tags    []Tags
+		adopted bool
+	}{
+		"matching tags": {
+			tags:    []Tags{{Key: aws.String("team"), Value: aws.String("platform")}},
+			adopted: true,
+		},
+		"no tags": {},
+		"different value": {
+			tags: []Tags{{Key: aws.String("team"), Value: aws.String("data")}},
+		},
+		"missing tag": {
+			tags: []Tags{{Key: aws.String("team"), Value: aws.String("platform")}, {Key: aws.String("env"), Value: aws.String("prod")}},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cluster := testCluster("ACTIVE", "1.23")
+			cluster.Tags = aws.StringMap(map[string]string{"team": "platform", "aws:cloudformation:stack-name": "other"})
+			model := testModel("1.23")
+			model.Tags = tc.tags
+			err := adoptCluster(&mockEKSClient{cluster: cluster}, model)
+			if tc.adopted && err != nil {
+				t.Errorf("expected the cluster to be adopted, got %v", err)
+			}
+			if !tc.adopted && !matchesAwsErrorCode(err, eks.ErrCodeResourceInUseException) {
+				t.Errorf("expected a resource in use error, got %v", err)
+			}
+		})
+	}
+}
+
+type mockListClient struct {
+	mockEKSClient
+	pages map[string]*eks.ListClustersOutput
+}
+
+func (m *mockListClient) ListClusters(input *eks.ListClustersInput) (*eks.ListClustersOutput, error) {
+	return m.pages[aws.StringValue(input.NextToken)], nil
+}
+
+func TestListClusters(t *testing.T) {
+	svc := &mockListClient{pages: map[string]*eks.ListClustersOutput{
+		"":       {Clusters: aws.StringSlice([]string{"one", "two"}), NextToken: aws.String("page-2")},
+		"page-2": {Clusters: aws.StringSlice([]string{"three"})},
+	}}
+	tests := map[string]struct {
+		nextToken string
+		names     []string
+		expected  string
+	}{
+		"first page": {
+			names:    []string{"one", "two"},
+			expected: "page-2",
+		},
+		"last page": {
+			nextToken: "page-2",
+			names:     []string{"three"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			event := listClusters(svc, tc.nextToken)
+			var names []string
+			for _, m := range event.ResourceModels {
+				names = append(names, *m.(*Model).Name)
+			}
+			if !reflect.DeepEqual(names, tc.names) || event.NextToken != tc.expected {
+				t.Errorf("expected %v and next token %q, got %v and %q", tc.names, tc.expected, names, event.NextToken)
+			}
+		})
+	}
+}
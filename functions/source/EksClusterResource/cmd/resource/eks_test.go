@@ -0,0 +1,387 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPlanVersionUpgrade(t *testing.T) {
+	tests := map[string]struct {
+		current  string
+		desired  string
+		expected []string
+		invalid  bool
+	}{
+		"same version": {
+			current: "1.27",
+			desired: "1.27",
+		},
+		"one minor version": {
+			current:  "1.27",
+			desired:  "1.28",
+			expected: []string{"1.28"},
+		},
+		"several minor versions": {
+			current:  "1.27",
+			desired:  "1.30",
+			expected: []string{"1.28", "1.29", "1.30"},
+		},
+		"platform version suffix": {
+			current:  "1.27.eks.3",
+			desired:  "1.29",
+			expected: []string{"1.28", "1.29"},
+		},
+		"downgrade": {
+			current: "1.29",
+			desired: "1.27",
+			invalid: true,
+		},
+		"major version": {
+			current: "1.29",
+			desired: "2.0",
+			invalid: true,
+		},
+		"invalid desired version": {
+			current: "1.29",
+			desired: "latest",
+			invalid: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			plan, err := planVersionUpgrade(tc.current, tc.desired)
+			if tc.invalid {
+				if !matchesAwsErrorCode(err, eks.ErrCodeInvalidParameterException) {
+					t.Errorf("expected an invalid request error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(plan, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, plan)
+			}
+		})
+	}
+}
+
+func TestDiffTags(t *testing.T) {
+	tests := map[string]struct {
+		current map[string]string
+		desired map[string]string
+		added   map[string]*string
+		removed []*string
+	}{
+		"unchanged": {
+			current: map[string]string{"team": "platform"},
+			desired: map[string]string{"team": "platform"},
+		},
+		"added": {
+			current: map[string]string{"team": "platform"},
+			desired: map[string]string{"team": "platform", "env": "prod"},
+			added:   map[string]*string{"env": aws.String("prod")},
+		},
+		"changed": {
+			current: map[string]string{"team": "platform"},
+			desired: map[string]string{"team": "data"},
+			added:   map[string]*string{"team": aws.String("data")},
+		},
+		"removed": {
+			current: map[string]string{"team": "platform", "env": "prod"},
+			desired: map[string]string{"team": "platform"},
+			removed: []*string{aws.String("env")},
+		},
+		"all removed": {
+			current: map[string]string{"team": "platform"},
+			desired: map[string]string{},
+			removed: []*string{aws.String("team")},
+		},
+		"aws tags kept": {
+			current: map[string]string{"aws:cloudformation:stack-name": "stack"},
+			desired: map[string]string{},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			added, removed := diffTags(tc.current, tc.desired)
+			if !reflect.DeepEqual(added, tc.added) {
+				t.Errorf("expected added %v, got %v", aws.StringValueMap(tc.added), aws.StringValueMap(added))
+			}
+			if !reflect.DeepEqual(removed, tc.removed) {
+				t.Errorf("expected removed %v, got %v", aws.StringValueSlice(tc.removed), aws.StringValueSlice(removed))
+			}
+		})
+	}
+}
+
+func TestGenerateClusterName(t *testing.T) {
+	stackId := "arn:aws:cloudformation:us-east-1:123456789012:stack/stack/0a1b2c3d"
+	model := &Model{RoleArn: aws.String("arn:aws:iam::123456789012:role/eks"), Version: aws.String("1.29")}
+	seed := createRequestSeed(model, stackId, "Cluster", "create-1")
+	name := aws.StringValue(generateClusterName("Cluster", seed))
+	if !regexp.MustCompile(`^EKS-Cluster-[0-9A-F]{8}$`).MatchString(name) {
+		t.Errorf("unexpected generated name %v", name)
+	}
+	tests := map[string]struct {
+		model     *Model
+		stackId   string
+		logicalId string
+		createId  string
+		same      bool
+	}{
+		"retried create": {
+			model:     &Model{RoleArn: aws.String("arn:aws:iam::123456789012:role/eks"), Version: aws.String("1.29")},
+			stackId:   stackId,
+			logicalId: "Cluster",
+			createId:  "create-1",
+			same:      true,
+		},
+		"created again": {
+			model:     &Model{RoleArn: aws.String("arn:aws:iam::123456789012:role/eks"), Version: aws.String("1.29")},
+			stackId:   stackId,
+			logicalId: "Cluster",
+			createId:  "create-2",
+		},
+		"property updated in place": {
+			model:     &Model{RoleArn: aws.String("arn:aws:iam::123456789012:role/eks"), Version: aws.String("1.30")},
+			stackId:   stackId,
+			logicalId: "Cluster",
+			createId:  "create-1",
+			same:      true,
+		},
+		"replacement": {
+			model:     &Model{RoleArn: aws.String("arn:aws:iam::123456789012:role/other")},
+			stackId:   stackId,
+			logicalId: "Cluster",
+			createId:  "create-1",
+		},
+		"other stack": {
+			model:     model,
+			stackId:   "arn:aws:cloudformation:us-east-1:123456789012:stack/stack/4e5f6a7b",
+			logicalId: "Cluster",
+			createId:  "create-1",
+		},
+		"other logical ID": {
+			model:     model,
+			stackId:   stackId,
+			logicalId: "Cluster2",
+			createId:  "create-1",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			other := createRequestSeed(tc.model, tc.stackId, tc.logicalId, tc.createId)
+			if same := other == seed; same != tc.same {
+				t.Errorf("expected same seed to be %v, got %v", tc.same, same)
+			}
+			if same := *generateClusterName(tc.logicalId, other) == *generateClusterName("Cluster", seed); same != tc.same {
+				t.Errorf("expected same name to be %v, got %v", tc.same, same)
+			}
+			if same := *clientRequestToken(other) == *clientRequestToken(seed); same != tc.same {
+				t.Errorf("expected same token to be %v, got %v", tc.same, same)
+			}
+		})
+	}
+}
+
+func TestGenerateClusterNameLength(t *testing.T) {
+	tests := map[string]struct {
+		logicalId string
+		pattern   string
+	}{
+		"no logical ID":   {logicalId: "", pattern: `^EKS-[0-9A-F]{8}$`},
+		"long logical ID": {logicalId: strings.Repeat("A", 255), pattern: `^EKS-A{40}-[0-9A-F]{8}$`},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			generated := aws.StringValue(generateClusterName(tc.logicalId, "seed"))
+			if !regexp.MustCompile(tc.pattern).MatchString(generated) {
+				t.Errorf("expected a name matching %v, got %v", tc.pattern, generated)
+			}
+		})
+	}
+}
+
+func TestValidateEncryptionChange(t *testing.T) {
+	key := "arn:aws:kms:us-east-1:123456789012:key/1"
+	secrets := []EncryptionConfigEntry{{Resources: []string{"secrets"}, Provider: &Provider{KeyArn: aws.String(key)}}}
+	tests := map[string]struct {
+		current []EncryptionConfigEntry
+		desired []EncryptionConfigEntry
+		invalid bool
+	}{
+		"not encrypted": {},
+		"enabled": {
+			desired: secrets,
+		},
+		"unchanged": {
+			current: secrets,
+			desired: []EncryptionConfigEntry{{Resources: []string{"secrets"}, Provider: &Provider{KeyArn: aws.String(key)}}},
+		},
+		"disabled": {
+			current: secrets,
+			invalid: true,
+		},
+		"key changed": {
+			current: secrets,
+			desired: []EncryptionConfigEntry{{Resources: []string{"secrets"}, Provider: &Provider{KeyArn: aws.String("arn:aws:kms:us-east-1:123456789012:key/2")}}},
+			invalid: true,
+		},
+		"provider removed": {
+			current: secrets,
+			desired: []EncryptionConfigEntry{{Resources: []string{"secrets"}}},
+			invalid: true,
+		},
+		"resources changed": {
+			current: secrets,
+			desired: []EncryptionConfigEntry{{Resources: []string{"secrets", "configmaps"}, Provider: &Provider{KeyArn: aws.String(key)}}},
+			invalid: true,
+		},
+		"resources removed": {
+			current: secrets,
+			desired: []EncryptionConfigEntry{{Provider: &Provider{KeyArn: aws.String(key)}}},
+			invalid: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateEncryptionChange(Model{EncryptionConfig: tc.current}, Model{EncryptionConfig: tc.desired})
+			if tc.invalid != matchesAwsErrorCode(err, eks.ErrCodeInvalidParameterException) || (!tc.invalid && err != nil) {
+				t.Errorf("expected invalid to be %v, got %v", tc.invalid, err)
+			}
+		})
+	}
+}
+
+func TestMakeCreateClusterInputNetworkConfig(t *testing.T) {
+	tests := map[string]struct {
+		config   *KubernetesNetworkConfig
+		expected *eks.KubernetesNetworkConfigRequest
+	}{
+		"defaults": {
+			expected: &eks.KubernetesNetworkConfigRequest{},
+		},
+		"ipv4": {
+			config:   &KubernetesNetworkConfig{ServiceIpv4Cidr: aws.String("10.100.0.0/16")},
+			expected: &eks.KubernetesNetworkConfigRequest{ServiceIpv4Cidr: aws.String("10.100.0.0/16")},
+		},
+		"ipv6": {
+			config:   &KubernetesNetworkConfig{IpFamily: aws.String(eks.IpFamilyIpv6)},
+			expected: &eks.KubernetesNetworkConfigRequest{IpFamily: aws.String(eks.IpFamilyIpv6)},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			model := testModel("1.23")
+			model.KubernetesNetworkConfig = tc.config
+			input := makeCreateClusterInput(model)
+			if !reflect.DeepEqual(input.KubernetesNetworkConfig, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, input.KubernetesNetworkConfig)
+			}
+		})
+	}
+}
+
+func TestMakeCreateClusterInputEndpointAccess(t *testing.T) {
+	tests := map[string]struct {
+		privateBootstrap *bool
+		expected         bool
+	}{
+		"not set": {
+			expected: true,
+		},
+		"disabled": {
+			privateBootstrap: aws.Bool(false),
+			expected:         true,
+		},
+		"private bootstrap": {
+			privateBootstrap: aws.Bool(true),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			model := testModel("1.23")
+			model.PrivateBootstrap = tc.privateBootstrap
+			input := makeCreateClusterInput(model)
+			if public := *input.ResourcesVpcConfig.EndpointPublicAccess; public != tc.expected {
+				t.Errorf("expected the public endpoint to be %v, got %v", tc.expected, public)
+			}
+			if !*input.ResourcesVpcConfig.EndpointPrivateAccess {
+				t.Error("expected the private endpoint to be enabled")
+			}
+		})
+	}
+}
+
+func TestSubnetsChanged(t *testing.T) {
+	tests := map[string]struct {
+		subnets        []string
+		securityGroups []string
+		expected       bool
+	}{
+		"unchanged": {
+			subnets:        []string{"subnet-2", "subnet-1"},
+			securityGroups: []string{"sg-1"},
+		},
+		"default subnets": {
+			securityGroups: []string{"sg-1"},
+		},
+		"subnet added": {
+			subnets:        []string{"subnet-2", "subnet-1", "subnet-3"},
+			securityGroups: []string{"sg-1"},
+			expected:       true,
+		},
+		"security group replaced": {
+			subnets:        []string{"subnet-1", "subnet-2"},
+			securityGroups: []string{"sg-2"},
+			expected:       true,
+		},
+		"security groups removed": {
+			subnets:  []string{"subnet-1", "subnet-2"},
+			expected: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			current := Model{ResourcesVpcConfig: &ResourcesVpcConfig{SubnetIds: []string{"subnet-1", "subnet-2"}, SecurityGroupIds: []string{"sg-1"}}}
+			desired := Model{ResourcesVpcConfig: &ResourcesVpcConfig{SubnetIds: tc.subnets, SecurityGroupIds: tc.securityGroups}}
+			subnets := append([]string(nil), tc.subnets...)
+			if changed := subnetsChanged(current, desired); changed != tc.expected {
+				t.Errorf("expected changed to be %v, got %v", tc.expected, changed)
+			}
+			if len(subnets) > 0 && !reflect.DeepEqual(desired.ResourcesVpcConfig.SubnetIds, subnets) {
+				t.Errorf("expected the subnets of the model to be left in order, got %v", desired.ResourcesVpcConfig.SubnetIds)
+			}
+		})
+	}
+}
+
+func TestDescribeClusterToModel(t *testing.T) {
+	cluster := testCluster("ACTIVE", "1.23")
+	cluster.Tags = aws.StringMap(map[string]string{"team": "platform", "env": "prod", "aws:cloudformation:stack-name": "stack"})
+	cluster.Logging = &eks.Logging{ClusterLogging: []*eks.LogSetup{{Enabled: aws.Bool(true), Types: aws.StringSlice([]string{"api"})}}}
+	model := &Model{
+		Tags:                       []Tags{{Key: aws.String("stale"), Value: aws.String("tag")}},
+		EnabledClusterLoggingTypes: []string{"audit"},
+		EncryptionConfig:           []EncryptionConfigEntry{{Resources: []string{"secrets"}}},
+	}
+	describeClusterToModel(*cluster, model)
+	expectedTags := []Tags{{Key: aws.String("env"), Value: aws.String("prod")}, {Key: aws.String("team"), Value: aws.String("platform")}}
+	if !reflect.DeepEqual(model.Tags, expectedTags) {
+		t.Errorf("expected tags %v, got %v", expectedTags, model.Tags)
+	}
+	if !reflect.DeepEqual(model.EnabledClusterLoggingTypes, []string{"api"}) {
+		t.Errorf("expected logging types [api], got %v", model.EnabledClusterLoggingTypes)
+	}
+	if model.EncryptionConfig != nil {
+		t.Errorf("expected no encryption config, got %v", model.EncryptionConfig)
+	}
+	if model.ResourcesVpcConfig.PublicAccessCidrs != nil {
+		t.Errorf("expected the default public access CIDRs to be left out, got %v", model.ResourcesVpcConfig.PublicAccessCidrs)
+	}
+}
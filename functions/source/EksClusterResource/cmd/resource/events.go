@@ -3,10 +3,12 @@ package resource
 import (
 	"fmt"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/eks"
 	"log"
+	"strings"
 )
 
 const (
@@ -16,6 +18,9 @@ const (
 func errorEvent(model *Model, err error) handler.ProgressEvent {
 	log.Println("Returning ERROR...")
 	errorType := cloudformation.HandlerErrorCodeGeneralServiceException
+	if uerr, ok := err.(updateError); ok {
+		errorType = updateErrorCode(uerr.update)
+	}
 	if aerr, ok := err.(awserr.Error); ok {
 		switch aerr.Code() {
 		case eks.ErrCodeResourceLimitExceededException:
@@ -40,6 +45,28 @@ func errorEvent(model *Model, err error) handler.ProgressEvent {
 	}
 }
 
+// updateErrorCode maps the first error EKS reported for a failed cluster update to a handler error code.
+func updateErrorCode(update *eks.Update) string {
+	if len(update.Errors) == 0 {
+		return cloudformation.HandlerErrorCodeGeneralServiceException
+	}
+	switch aws.StringValue(update.Errors[0].ErrorCode) {
+	case eks.ErrorCodeAccessDenied:
+		return cloudformation.HandlerErrorCodeAccessDenied
+	case eks.ErrorCodeSubnetNotFound, eks.ErrorCodeSecurityGroupNotFound, eks.ErrorCodeVpcIdNotFound,
+		eks.ErrorCodeOperationNotPermitted, eks.ErrorCodeConfigurationConflict:
+		return cloudformation.HandlerErrorCodeInvalidRequest
+	case eks.ErrorCodeEniLimitReached, eks.ErrorCodeIpNotAvailable, eks.ErrorCodeInsufficientFreeAddresses:
+		return cloudformation.HandlerErrorCodeServiceLimitExceeded
+	}
+	return cloudformation.HandlerErrorCodeGeneralServiceException
+}
+
+// invalidRequestError wraps a validation failure so that errorEvent reports it as InvalidRequest.
+func invalidRequestError(message string) error {
+	return awserr.New(eks.ErrCodeInvalidParameterException, message, nil)
+}
+
 func successEvent(model *Model) handler.ProgressEvent {
 	log.Println("Returning SUCCESS...")
 	return handler.ProgressEvent{
@@ -54,11 +81,50 @@ func inProgressEvent(model *Model, stage Stage) handler.ProgressEvent {
 		OperationStatus:      handler.InProgress,
 		ResourceModel:        model,
 		Message:              fmt.Sprintf("%v in progress\n", stage),
-		CallbackContext:      map[string]interface{}{"Stage": stage},
+		CallbackContext:      map[string]interface{}{"Stage": stage, "ClusterName": *model.Name},
 		CallbackDelaySeconds: callbackDelaySeconds,
 	}
 }
 
+// versionUpgradeEvent reports which hop of a multi-step version upgrade is in progress, along with any readiness
+// warnings, and keeps the upgrade progress in the callback context for the next invocation.
+func versionUpgradeEvent(model *Model, upgrade *versionUpgrade) handler.ProgressEvent {
+	event := inProgressEvent(model, VersionUpgradeStage)
+	event.CallbackContext["VersionPlan"] = upgrade.Plan
+	event.CallbackContext["VersionHop"] = upgrade.Hop
+	if upgrade.UpdateId != nil {
+		event.CallbackContext["UpdateId"] = *upgrade.UpdateId
+	}
+	if upgrade.Hop >= 1 && upgrade.Hop <= len(upgrade.Plan) {
+		event.Message = fmt.Sprintf("Upgrading Kubernetes version to %v (step %v of %v)\n", upgrade.Plan[upgrade.Hop-1], upgrade.Hop, len(upgrade.Plan))
+	} else {
+		event.Message = fmt.Sprintf("Upgrading Kubernetes version to %v\n", aws.StringValue(model.Version))
+	}
+	if len(upgrade.Warnings) > 0 {
+		event.CallbackContext["VersionWarnings"] = upgrade.Warnings
+		event.Message += fmt.Sprintf("Readiness warnings: %v\n", strings.Join(upgrade.Warnings, "; "))
+	}
+	return event
+}
+
+// updateClusterEvent keeps the ID of the cluster update being waited for in the callback context, so the next
+// invocation polls that update instead of starting another one.
+func updateClusterEvent(model *Model, updateId *string) handler.ProgressEvent {
+	event := inProgressEvent(model, UpdateClusterStage)
+	if updateId != nil {
+		event.CallbackContext["UpdateId"] = *updateId
+	}
+	return event
+}
+
+// createIdEvent keeps the ID of the create in the callback context, so that retries of the invocation that creates the
+// cluster use the same request token.
+func createIdEvent(model *Model, createId string) handler.ProgressEvent {
+	event := inProgressEvent(model, InitStage)
+	event.CallbackContext["CreateId"] = createId
+	return event
+}
+
 func makeEvent(model *Model, nextStage Stage, err error) handler.ProgressEvent {
 	if err != nil {
 		return errorEvent(model, err)
@@ -0,0 +1,220 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"log"
+	"reflect"
+	"strings"
+)
+
+func makeCreateFargateProfileInput(model *Model, profile FargateProfile) *eks.CreateFargateProfileInput {
+	input := &eks.CreateFargateProfileInput{
+		ClusterName:         model.Name,
+		FargateProfileName:  profile.Name,
+		PodExecutionRoleArn: profile.PodExecutionRoleArn,
+		Selectors:           createFargateSelectors(profile.Selectors),
+	}
+	if profile.Subnets != nil {
+		input.Subnets = aws.StringSlice(profile.Subnets)
+	}
+	if model.Tags != nil && len(model.Tags) > 0 {
+		input.Tags = make(map[string]*string)
+		for _, tag := range model.Tags {
+			input.Tags[*tag.Key] = tag.Value
+		}
+	}
+	return input
+}
+
+func createFargateSelectors(selectors []FargateProfileSelector) []*eks.FargateProfileSelector {
+	var eksSelectors []*eks.FargateProfileSelector
+	for _, s := range selectors {
+		selector := &eks.FargateProfileSelector{Namespace: s.Namespace}
+		if len(s.Labels) > 0 {
+			selector.Labels = aws.StringMap(s.Labels)
+		}
+		eksSelectors = append(eksSelectors, selector)
+	}
+	return eksSelectors
+}
+
+// reconcileFargateProfiles creates, replaces and deletes Fargate profiles one at a time, as EKS only allows a single
+// profile operation per cluster. Profiles are processed in a fixed order and the first one that is not settled ends
+// the invocation, so that a new operation is never started while another is still running. Profiles are immutable,
+// so a changed profile is deleted and created again under the same name.
+func reconcileFargateProfiles(svc eksiface.EKSAPI, desired *Model, previous *Model) (OperationComplete, error) {
+	for _, name := range removedFargateProfiles(previous, desired) {
+		current, err := describeFargateProfile(svc, desired.Name, name)
+		if err != nil {
+			return Complete, err
+		}
+		if current == nil {
+			continue
+		}
+		return deleteFargateProfile(svc, desired.Name, current)
+	}
+	for _, profile := range desired.FargateProfiles {
+		current, err := describeFargateProfile(svc, desired.Name, profile.Name)
+		if err != nil {
+			return Complete, err
+		}
+		if current == nil {
+			log.Printf("Creating Fargate profile %v...\n", *profile.Name)
+			_, err = svc.CreateFargateProfile(makeCreateFargateProfileInput(desired, profile))
+			if err != nil && !matchesAwsErrorCode(err, eks.ErrCodeResourceInUseException) {
+				return Complete, err
+			}
+			return InProgress, nil
+		}
+		switch *current.Status {
+		case eks.FargateProfileStatusActive:
+			if fargateProfileChanged(profile, current) {
+				log.Printf("Replacing Fargate profile %v...\n", *profile.Name)
+				return deleteFargateProfile(svc, desired.Name, current)
+			}
+		case eks.FargateProfileStatusCreateFailed, eks.FargateProfileStatusDeleteFailed:
+			return Complete, fargateProfileHealthError(current)
+		default:
+			return InProgress, nil
+		}
+	}
+	return Complete, nil
+}
+
+func describeFargateProfile(svc eksiface.EKSAPI, clusterName *string, name *string) (*eks.FargateProfile, error) {
+	response, err := svc.DescribeFargateProfile(&eks.DescribeFargateProfileInput{ClusterName: clusterName, FargateProfileName: name})
+	if err != nil {
+		if matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return response.FargateProfile, nil
+}
+
+// listPodExecutionRoles returns the pod execution roles of every Fargate profile of the cluster, including the ones
+// not declared in the model.
+func listPodExecutionRoles(svc eksiface.EKSAPI, clusterName *string) ([]string, error) {
+	var names []*string
+	input := &eks.ListFargateProfilesInput{ClusterName: clusterName}
+	err := svc.ListFargateProfilesPages(input, func(page *eks.ListFargateProfilesOutput, lastPage bool) bool {
+		names = append(names, page.FargateProfileNames...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	var roles []string
+	for _, name := range names {
+		profile, err := describeFargateProfile(svc, clusterName, name)
+		if err != nil {
+			return nil, err
+		}
+		if profile != nil && profile.PodExecutionRoleArn != nil {
+			roles = append(roles, *profile.PodExecutionRoleArn)
+		}
+	}
+	return roles, nil
+}
+
+func fargateProfileChanged(desired FargateProfile, current *eks.FargateProfile) bool {
+	if aws.StringValue(desired.PodExecutionRoleArn) != aws.StringValue(current.PodExecutionRoleArn) {
+		return true
+	}
+	// slicesEqual sorts its arguments, so compare a copy
+	if desired.Subnets != nil && !slicesEqual(append([]string(nil), desired.Subnets...), aws.StringValueSlice(current.Subnets)) {
+		return true
+	}
+	if len(desired.Selectors) != len(current.Selectors) {
+		return true
+	}
+	for i, s := range desired.Selectors {
+		c := current.Selectors[i]
+		if aws.StringValue(s.Namespace) != aws.StringValue(c.Namespace) {
+			return true
+		}
+		if (len(s.Labels) > 0 || len(c.Labels) > 0) && !reflect.DeepEqual(s.Labels, aws.StringValueMap(c.Labels)) {
+			return true
+		}
+	}
+	return false
+}
+
+func removedFargateProfiles(previous *Model, desired *Model) []*string {
+	if previous == nil {
+		return nil
+	}
+	var removed []*string
+	for _, p := range previous.FargateProfiles {
+		found := false
+		for _, d := range desired.FargateProfiles {
+			if *p.Name == *d.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed = append(removed, p.Name)
+		}
+	}
+	return removed
+}
+
+// deleteFargateProfiles deletes every Fargate profile of the cluster one at a time, including the ones not declared in
+// the model, and returns Complete once all are gone.
+func deleteFargateProfiles(svc eksiface.EKSAPI, model *Model) (OperationComplete, error) {
+	var names []*string
+	input := &eks.ListFargateProfilesInput{ClusterName: model.Name}
+	err := svc.ListFargateProfilesPages(input, func(page *eks.ListFargateProfilesOutput, lastPage bool) bool {
+		names = append(names, page.FargateProfileNames...)
+		return true
+	})
+	if err != nil {
+		if matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return Complete, nil
+		}
+		return Complete, err
+	}
+	for _, name := range names {
+		current, err := describeFargateProfile(svc, model.Name, name)
+		if err != nil {
+			return Complete, err
+		}
+		if current == nil {
+			continue
+		}
+		_, err = deleteFargateProfile(svc, model.Name, current)
+		return InProgress, err
+	}
+	return Complete, nil
+}
+
+func deleteFargateProfile(svc eksiface.EKSAPI, clusterName *string, profile *eks.FargateProfile) (OperationComplete, error) {
+	switch *profile.Status {
+	case eks.FargateProfileStatusDeleting, eks.FargateProfileStatusCreating:
+		return InProgress, nil
+	case eks.FargateProfileStatusDeleteFailed:
+		return Complete, fargateProfileHealthError(profile)
+	}
+	log.Printf("Deleting Fargate profile %v...\n", *profile.FargateProfileName)
+	_, err := svc.DeleteFargateProfile(&eks.DeleteFargateProfileInput{ClusterName: clusterName, FargateProfileName: profile.FargateProfileName})
+	if err != nil && !matchesAwsErrorCode(err, eks.ErrCodeResourceInUseException) &&
+		!matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+		return Complete, err
+	}
+	return InProgress, nil
+}
+
+func fargateProfileHealthError(profile *eks.FargateProfile) error {
+	var issues []string
+	if profile.Health != nil {
+		for _, issue := range profile.Health.Issues {
+			issues = append(issues, fmt.Sprintf("[%v] %v", aws.StringValue(issue.Code), aws.StringValue(issue.Message)))
+		}
+	}
+	return errors.New(fmt.Sprintf("Fargate profile %v status is %v: %v", *profile.FargateProfileName, *profile.Status, strings.Join(issues, "; ")))
+}
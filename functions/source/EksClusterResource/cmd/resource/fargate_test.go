@@ -0,0 +1,255 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func testFargateProfile() FargateProfile {
+	return FargateProfile{
+		Name:                aws.String("apps"),
+		PodExecutionRoleArn: aws.String("arn:aws:iam::123456789012:role/pods"),
+		Subnets:             []string{"subnet-2", "subnet-1"},
+		Selectors:           []FargateProfileSelector{{Namespace: aws.String("apps"), Labels: map[string]string{"runtime": "fargate"}}},
+	}
+}
+
+func testEksFargateProfile(status string) *eks.FargateProfile {
+	return &eks.FargateProfile{
+		FargateProfileName:  aws.String("apps"),
+		PodExecutionRoleArn: aws.String("arn:aws:iam::123456789012:role/pods"),
+		Subnets:             aws.StringSlice([]string{"subnet-1", "subnet-2"}),
+		Selectors:           []*eks.FargateProfileSelector{{Namespace: aws.String("apps"), Labels: aws.StringMap(map[string]string{"runtime": "fargate"})}},
+		Status:              aws.String(status),
+	}
+}
+
+func TestFargateProfileChanged(t *testing.T) {
+	tests := map[string]struct {
+		change   func(*FargateProfile)
+		expected bool
+	}{
+		"unchanged": {
+			change: func(*FargateProfile) {},
+		},
+		"default subnets": {
+			change: func(p *FargateProfile) { p.Subnets = nil },
+		},
+		"pod execution role": {
+			change:   func(p *FargateProfile) { p.PodExecutionRoleArn = aws.String("arn:aws:iam::123456789012:role/other") },
+			expected: true,
+		},
+		"subnets": {
+			change:   func(p *FargateProfile) { p.Subnets = []string{"subnet-3"} },
+			expected: true,
+		},
+		"selector namespace": {
+			change:   func(p *FargateProfile) { p.Selectors[0].Namespace = aws.String("jobs") },
+			expected: true,
+		},
+		"selector labels": {
+			change:   func(p *FargateProfile) { p.Selectors[0].Labels = nil },
+			expected: true,
+		},
+		"selector added": {
+			change: func(p *FargateProfile) {
+				p.Selectors = append(p.Selectors, FargateProfileSelector{Namespace: aws.String("jobs")})
+			},
+			expected: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			profile := testFargateProfile()
+			tc.change(&profile)
+			subnets := append([]string(nil), profile.Subnets...)
+			if changed := fargateProfileChanged(profile, testEksFargateProfile(eks.FargateProfileStatusActive)); changed != tc.expected {
+				t.Errorf("expected changed to be %v, got %v", tc.expected, changed)
+			}
+			if !reflect.DeepEqual(profile.Subnets, subnets) {
+				t.Errorf("expected the subnets of the model to be left in order, got %v", profile.Subnets)
+			}
+		})
+	}
+}
+
+func TestRemovedFargateProfiles(t *testing.T) {
+	apps := FargateProfile{Name: aws.String("apps")}
+	jobs := FargateProfile{Name: aws.String("jobs")}
+	tests := map[string]struct {
+		previous *Model
+		desired  *Model
+		expected []string
+	}{
+		"create": {
+			desired: &Model{FargateProfiles: []FargateProfile{apps}},
+		},
+		"unchanged": {
+			previous: &Model{FargateProfiles: []FargateProfile{apps, jobs}},
+			desired:  &Model{FargateProfiles: []FargateProfile{jobs, apps}},
+		},
+		"removed": {
+			previous: &Model{FargateProfiles: []FargateProfile{apps, jobs}},
+			desired:  &Model{FargateProfiles: []FargateProfile{apps}},
+			expected: []string{"jobs"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			removed := aws.StringValueSlice(removedFargateProfiles(tc.previous, tc.desired))
+			if len(removed) == 0 {
+				removed = nil
+			}
+			if !reflect.DeepEqual(removed, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, removed)
+			}
+		})
+	}
+}
+
+type mockFargateClient struct {
+	mockEKSClient
+	profiles map[string]*eks.FargateProfile
+	calls    []string
+}
+
+func (m *mockFargateClient) DescribeFargateProfile(input *eks.DescribeFargateProfileInput) (*eks.DescribeFargateProfileOutput, error) {
+	profile, ok := m.profiles[*input.FargateProfileName]
+	if !ok {
+		return nil, awserr.New(eks.ErrCodeResourceNotFoundException, "Fargate profile not found", nil)
+	}
+	return &eks.DescribeFargateProfileOutput{FargateProfile: profile}, nil
+}
+
+func (m *mockFargateClient) ListFargateProfilesPages(_ *eks.ListFargateProfilesInput, fn func(*eks.ListFargateProfilesOutput, bool) bool) error {
+	var names []string
+	for name := range m.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fn(&eks.ListFargateProfilesOutput{FargateProfileNames: aws.StringSlice(names)}, true)
+	return nil
+}
+
+func (m *mockFargateClient) CreateFargateProfile(input *eks.CreateFargateProfileInput) (*eks.CreateFargateProfileOutput, error) {
+	m.calls = append(m.calls, "create "+*input.FargateProfileName)
+	return &eks.CreateFargateProfileOutput{}, nil
+}
+
+func (m *mockFargateClient) DeleteFargateProfile(input *eks.DeleteFargateProfileInput) (*eks.DeleteFargateProfileOutput, error) {
+	m.calls = append(m.calls, "delete "+*input.FargateProfileName)
+	return &eks.DeleteFargateProfileOutput{}, nil
+}
+
+func TestReconcileFargateProfiles(t *testing.T) {
+	changed := testFargateProfile()
+	changed.PodExecutionRoleArn = aws.String("arn:aws:iam::123456789012:role/other")
+	jobs := testEksFargateProfile(eks.FargateProfileStatusActive)
+	jobs.FargateProfileName = aws.String("jobs")
+	tests := map[string]struct {
+		profiles map[string]*eks.FargateProfile
+		desired  []FargateProfile
+		previous []FargateProfile
+		complete OperationComplete
+		calls    []string
+		failed   bool
+	}{
+		"active": {
+			profiles: map[string]*eks.FargateProfile{"apps": testEksFargateProfile(eks.FargateProfileStatusActive)},
+			desired:  []FargateProfile{testFargateProfile()},
+			complete: Complete,
+		},
+		"created": {
+			profiles: map[string]*eks.FargateProfile{},
+			desired:  []FargateProfile{testFargateProfile()},
+			complete: InProgress,
+			calls:    []string{"create apps"},
+		},
+		"creating": {
+			profiles: map[string]*eks.FargateProfile{"apps": testEksFargateProfile(eks.FargateProfileStatusCreating)},
+			desired:  []FargateProfile{testFargateProfile()},
+			complete: InProgress,
+		},
+		"replaced": {
+			profiles: map[string]*eks.FargateProfile{"apps": testEksFargateProfile(eks.FargateProfileStatusActive)},
+			desired:  []FargateProfile{changed},
+			complete: InProgress,
+			calls:    []string{"delete apps"},
+		},
+		"removed one at a time": {
+			profiles: map[string]*eks.FargateProfile{"apps": testEksFargateProfile(eks.FargateProfileStatusActive), "jobs": jobs},
+			desired:  []FargateProfile{changed},
+			previous: []FargateProfile{testFargateProfile(), {Name: aws.String("jobs")}},
+			complete: InProgress,
+			calls:    []string{"delete jobs"},
+		},
+		"create failed": {
+			profiles: map[string]*eks.FargateProfile{"apps": testEksFargateProfile(eks.FargateProfileStatusCreateFailed)},
+			desired:  []FargateProfile{testFargateProfile()},
+			failed:   true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockFargateClient{profiles: tc.profiles}
+			desired := &Model{Name: aws.String("cluster"), FargateProfiles: tc.desired}
+			var previous *Model
+			if tc.previous != nil {
+				previous = &Model{Name: aws.String("cluster"), FargateProfiles: tc.previous}
+			}
+			complete, err := reconcileFargateProfiles(svc, desired, previous)
+			if tc.failed {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if complete != tc.complete || !reflect.DeepEqual(svc.calls, tc.calls) {
+				t.Errorf("expected complete %v after %v, got %v after %v", tc.complete, tc.calls, complete, svc.calls)
+			}
+		})
+	}
+}
+
+func TestDeleteFargateProfiles(t *testing.T) {
+	jobs := testEksFargateProfile(eks.FargateProfileStatusActive)
+	jobs.FargateProfileName = aws.String("jobs")
+	tests := map[string]struct {
+		profiles map[string]*eks.FargateProfile
+		complete OperationComplete
+		calls    []string
+	}{
+		"none left": {
+			profiles: map[string]*eks.FargateProfile{},
+			complete: Complete,
+		},
+		"one at a time": {
+			profiles: map[string]*eks.FargateProfile{"apps": testEksFargateProfile(eks.FargateProfileStatusActive), "jobs": jobs},
+			complete: InProgress,
+			calls:    []string{"delete apps"},
+		},
+		"deleting": {
+			profiles: map[string]*eks.FargateProfile{"apps": testEksFargateProfile(eks.FargateProfileStatusDeleting), "jobs": jobs},
+			complete: InProgress,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockFargateClient{profiles: tc.profiles}
+			complete, err := deleteFargateProfiles(svc, &Model{Name: aws.String("cluster")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if complete != tc.complete || !reflect.DeepEqual(svc.calls, tc.calls) {
+				t.Errorf("expected complete %v after %v, got %v after %v", tc.complete, tc.calls, complete, svc.calls)
+			}
+		})
+	}
+}
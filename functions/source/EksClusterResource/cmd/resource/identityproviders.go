@@ -0,0 +1,144 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"log"
+	"reflect"
+)
+
+const oidcIdentityProviderType = "oidc"
+
+func makeAssociateIdentityProviderConfigInput(model *Model, config IdentityProviderConfig) *eks.AssociateIdentityProviderConfigInput {
+	input := &eks.AssociateIdentityProviderConfigInput{
+		ClusterName: model.Name,
+		Oidc: &eks.OidcIdentityProviderConfigRequest{
+			IdentityProviderConfigName: config.Name,
+			IssuerUrl:                  config.IssuerUrl,
+			ClientId:                   config.ClientId,
+			UsernameClaim:              config.UsernameClaim,
+			UsernamePrefix:             config.UsernamePrefix,
+			GroupsClaim:                config.GroupsClaim,
+			GroupsPrefix:               config.GroupsPrefix,
+		},
+	}
+	if len(config.RequiredClaims) > 0 {
+		input.Oidc.RequiredClaims = aws.StringMap(config.RequiredClaims)
+	}
+	if model.Tags != nil && len(model.Tags) > 0 {
+		input.Tags = make(map[string]*string)
+		for _, tag := range model.Tags {
+			input.Tags[*tag.Key] = tag.Value
+		}
+	}
+	return input
+}
+
+// reconcileIdentityProviderConfigs associates the identity provider configs in the model and disassociates the
+// ones removed since the previous invocation. Associations can't be modified, so a changed config is disassociated
+// first and associated again once the disassociation has finished. Each association change is a cluster update, so
+// only one is started per invocation, and Complete is returned once every config is ACTIVE.
+func reconcileIdentityProviderConfigs(svc eksiface.EKSAPI, desired *Model, previous *Model) (OperationComplete, error) {
+	for _, name := range removedIdentityProviderConfigs(previous, desired) {
+		current, err := describeIdentityProviderConfig(svc, desired.Name, name)
+		if err != nil {
+			return Complete, err
+		}
+		if current == nil {
+			continue
+		}
+		if *current.Status != eks.ConfigStatusActive {
+			return InProgress, nil
+		}
+		return disassociateIdentityProviderConfig(svc, desired.Name, name)
+	}
+	for _, config := range desired.IdentityProviderConfigs {
+		current, err := describeIdentityProviderConfig(svc, desired.Name, config.Name)
+		if err != nil {
+			return Complete, err
+		}
+		if current == nil {
+			log.Printf("Associating identity provider config %v...\n", *config.Name)
+			_, err = svc.AssociateIdentityProviderConfig(makeAssociateIdentityProviderConfigInput(desired, config))
+			if err != nil && !updateInProgress(err) && !matchesAwsErrorCode(err, eks.ErrCodeResourceInUseException) {
+				return Complete, err
+			}
+			return InProgress, nil
+		}
+		if *current.Status != eks.ConfigStatusActive {
+			return InProgress, nil
+		}
+		if identityProviderConfigChanged(config, current) {
+			return disassociateIdentityProviderConfig(svc, desired.Name, config.Name)
+		}
+	}
+	return Complete, nil
+}
+
+func describeIdentityProviderConfig(svc eksiface.EKSAPI, clusterName *string, name *string) (*eks.OidcIdentityProviderConfig, error) {
+	response, err := svc.DescribeIdentityProviderConfig(&eks.DescribeIdentityProviderConfigInput{
+		ClusterName: clusterName,
+		IdentityProviderConfig: &eks.IdentityProviderConfig{
+			Name: name,
+			Type: aws.String(oidcIdentityProviderType),
+		},
+	})
+	if err != nil {
+		if matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return response.IdentityProviderConfig.Oidc, nil
+}
+
+func disassociateIdentityProviderConfig(svc eksiface.EKSAPI, clusterName *string, name *string) (OperationComplete, error) {
+	log.Printf("Disassociating identity provider config %v...\n", *name)
+	_, err := svc.DisassociateIdentityProviderConfig(&eks.DisassociateIdentityProviderConfigInput{
+		ClusterName: clusterName,
+		IdentityProviderConfig: &eks.IdentityProviderConfig{
+			Name: name,
+			Type: aws.String(oidcIdentityProviderType),
+		},
+	})
+	if err != nil && !updateInProgress(err) && !matchesAwsErrorCode(err, eks.ErrCodeResourceInUseException) {
+		return Complete, err
+	}
+	return InProgress, nil
+}
+
+func identityProviderConfigChanged(desired IdentityProviderConfig, current *eks.OidcIdentityProviderConfig) bool {
+	if aws.StringValue(desired.IssuerUrl) != aws.StringValue(current.IssuerUrl) ||
+		aws.StringValue(desired.ClientId) != aws.StringValue(current.ClientId) ||
+		aws.StringValue(desired.UsernameClaim) != aws.StringValue(current.UsernameClaim) ||
+		aws.StringValue(desired.UsernamePrefix) != aws.StringValue(current.UsernamePrefix) ||
+		aws.StringValue(desired.GroupsClaim) != aws.StringValue(current.GroupsClaim) ||
+		aws.StringValue(desired.GroupsPrefix) != aws.StringValue(current.GroupsPrefix) {
+		return true
+	}
+	if len(desired.RequiredClaims) == 0 && len(current.RequiredClaims) == 0 {
+		return false
+	}
+	return !reflect.DeepEqual(desired.RequiredClaims, aws.StringValueMap(current.RequiredClaims))
+}
+
+func removedIdentityProviderConfigs(previous *Model, desired *Model) []*string {
+	if previous == nil {
+		return nil
+	}
+	var removed []*string
+	for _, p := range previous.IdentityProviderConfigs {
+		found := false
+		for _, d := range desired.IdentityProviderConfigs {
+			if *p.Name == *d.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed = append(removed, p.Name)
+		}
+	}
+	return removed
+}
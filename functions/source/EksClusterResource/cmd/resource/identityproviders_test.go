@@ -0,0 +1,161 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"reflect"
+	"testing"
+)
+
+func testIdentityProviderConfig() IdentityProviderConfig {
+	return IdentityProviderConfig{
+		Name:           aws.String("corp"),
+		IssuerUrl:      aws.String("https://idp.example.com"),
+		ClientId:       aws.String("kubernetes"),
+		UsernameClaim:  aws.String("email"),
+		GroupsClaim:    aws.String("groups"),
+		RequiredClaims: map[string]string{"hd": "example.com"},
+	}
+}
+
+func testOidcIdentityProviderConfig(status string) *eks.OidcIdentityProviderConfig {
+	return &eks.OidcIdentityProviderConfig{
+		IdentityProviderConfigName: aws.String("corp"),
+		IssuerUrl:                  aws.String("https://idp.example.com"),
+		ClientId:                   aws.String("kubernetes"),
+		UsernameClaim:              aws.String("email"),
+		GroupsClaim:                aws.String("groups"),
+		RequiredClaims:             aws.StringMap(map[string]string{"hd": "example.com"}),
+		Status:                     aws.String(status),
+	}
+}
+
+func TestIdentityProviderConfigChanged(t *testing.T) {
+	tests := map[string]struct {
+		change   func(*IdentityProviderConfig)
+		expected bool
+	}{
+		"unchanged": {
+			change: func(*IdentityProviderConfig) {},
+		},
+		"issuer": {
+			change:   func(c *IdentityProviderConfig) { c.IssuerUrl = aws.String("https://other.example.com") },
+			expected: true,
+		},
+		"groups prefix": {
+			change:   func(c *IdentityProviderConfig) { c.GroupsPrefix = aws.String("oidc:") },
+			expected: true,
+		},
+		"required claims": {
+			change:   func(c *IdentityProviderConfig) { c.RequiredClaims = map[string]string{"hd": "corp.example.com"} },
+			expected: true,
+		},
+		"required claims removed": {
+			change:   func(c *IdentityProviderConfig) { c.RequiredClaims = nil },
+			expected: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := testIdentityProviderConfig()
+			tc.change(&config)
+			if changed := identityProviderConfigChanged(config, testOidcIdentityProviderConfig(eks.ConfigStatusActive)); changed != tc.expected {
+				t.Errorf("expected changed to be %v, got %v", tc.expected, changed)
+			}
+		})
+	}
+}
+
+type mockIdentityProviderClient struct {
+	mockEKSClient
+	configs       map[string]*eks.OidcIdentityProviderConfig
+	associated    []string
+	disassociated []string
+}
+
+func (m *mockIdentityProviderClient) DescribeIdentityProviderConfig(input *eks.DescribeIdentityProviderConfigInput) (*eks.DescribeIdentityProviderConfigOutput, error) {
+	config, ok := m.configs[*input.IdentityProviderConfig.Name]
+	if !ok {
+		return nil, awserr.New(eks.ErrCodeResourceNotFoundException, "identity provider config not found", nil)
+	}
+	return &eks.DescribeIdentityProviderConfigOutput{IdentityProviderConfig: &eks.IdentityProviderConfigResponse{Oidc: config}}, nil
+}
+
+func (m *mockIdentityProviderClient) AssociateIdentityProviderConfig(input *eks.AssociateIdentityProviderConfigInput) (*eks.AssociateIdentityProviderConfigOutput, error) {
+	m.associated = append(m.associated, *input.Oidc.IdentityProviderConfigName)
+	return &eks.AssociateIdentityProviderConfigOutput{}, nil
+}
+
+func (m *mockIdentityProviderClient) DisassociateIdentityProviderConfig(input *eks.DisassociateIdentityProviderConfigInput) (*eks.DisassociateIdentityProviderConfigOutput, error) {
+	m.disassociated = append(m.disassociated, *input.IdentityProviderConfig.Name)
+	return &eks.DisassociateIdentityProviderConfigOutput{}, nil
+}
+
+func TestReconcileIdentityProviderConfigs(t *testing.T) {
+	changed := testIdentityProviderConfig()
+	changed.ClientId = aws.String("other")
+	tests := map[string]struct {
+		configs       map[string]*eks.OidcIdentityProviderConfig
+		desired       []IdentityProviderConfig
+		previous      []IdentityProviderConfig
+		complete      OperationComplete
+		associated    []string
+		disassociated []string
+	}{
+		"active": {
+			configs:  map[string]*eks.OidcIdentityProviderConfig{"corp": testOidcIdentityProviderConfig(eks.ConfigStatusActive)},
+			desired:  []IdentityProviderConfig{testIdentityProviderConfig()},
+			complete: Complete,
+		},
+		"associated": {
+			configs:    map[string]*eks.OidcIdentityProviderConfig{},
+			desired:    []IdentityProviderConfig{testIdentityProviderConfig()},
+			complete:   InProgress,
+			associated: []string{"corp"},
+		},
+		"creating": {
+			configs:  map[string]*eks.OidcIdentityProviderConfig{"corp": testOidcIdentityProviderConfig(eks.ConfigStatusCreating)},
+			desired:  []IdentityProviderConfig{testIdentityProviderConfig()},
+			complete: InProgress,
+		},
+		"changed": {
+			configs:       map[string]*eks.OidcIdentityProviderConfig{"corp": testOidcIdentityProviderConfig(eks.ConfigStatusActive)},
+			desired:       []IdentityProviderConfig{changed},
+			complete:      InProgress,
+			disassociated: []string{"corp"},
+		},
+		"removed": {
+			configs:       map[string]*eks.OidcIdentityProviderConfig{"corp": testOidcIdentityProviderConfig(eks.ConfigStatusActive)},
+			previous:      []IdentityProviderConfig{testIdentityProviderConfig()},
+			complete:      InProgress,
+			disassociated: []string{"corp"},
+		},
+		"removed and gone": {
+			configs:  map[string]*eks.OidcIdentityProviderConfig{},
+			previous: []IdentityProviderConfig{testIdentityProviderConfig()},
+			complete: Complete,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockIdentityProviderClient{configs: tc.configs}
+			desired := &Model{Name: aws.String("cluster"), IdentityProviderConfigs: tc.desired}
+			var previous *Model
+			if tc.previous != nil {
+				previous = &Model{Name: aws.String("cluster"), IdentityProviderConfigs: tc.previous}
+			}
+			complete, err := reconcileIdentityProviderConfigs(svc, desired, previous)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if complete != tc.complete {
+				t.Errorf("expected complete to be %v, got %v", tc.complete, complete)
+			}
+			if !reflect.DeepEqual(svc.associated, tc.associated) || !reflect.DeepEqual(svc.disassociated, tc.disassociated) {
+				t.Errorf("expected associated %v and disassociated %v, got %v and %v",
+					tc.associated, tc.disassociated, svc.associated, svc.disassociated)
+			}
+		})
+	}
+}
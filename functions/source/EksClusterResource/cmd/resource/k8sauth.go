@@ -5,21 +5,28 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/eks"
 	"github.com/aws/aws-sdk-go/service/eks/eksiface"
 	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/aws/aws-sdk-go/service/sts"
+	yamlv2 "gopkg.in/yaml.v2"
 	v1 "k8s.io/api/core/v1"
 	rbac "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
 	"log"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+	"sigs.k8s.io/yaml"
 )
 
+// ownedArnsAnnotation records on the aws-auth ConfigMap the ARNs and account IDs of the entries this resource manages.
+const ownedArnsAnnotation = "awsqs.eks.cluster/owned-arns"
+
 func CreateKubeClientEks(session *session.Session, svc eksiface.EKSAPI, clusterName *string) (*kubernetes.Clientset, error) {
 	endpoint, token, caData, err := getEksLogin(session, svc, clusterName)
 	if err != nil {
@@ -90,20 +97,89 @@ func CreateKubeClientFromToken(endpoint string, token string, caData []byte) (*k
 }
 
 type IamAuthMap struct {
-	MapUsers []userMapping
-	MapRoles []roleMapping
+	MapUsers    []userMapping
+	MapRoles    []roleMapping
+	MapAccounts []string
+	// Owned holds the identities listed in the ownership annotation of the ConfigMap read from the cluster, and is nil
+	// when the ConfigMap has no annotation.
+	Owned []string `json:",omitempty"`
 }
 
 type userMapping struct {
 	UserArn  string   `json:"userarn,omitempty"`
 	Username string   `json:"username,omitempty"`
 	Groups   []string `json:"groups,omitempty"`
+	// Extra holds the fields of the entry this provider doesn't know about, so that they survive a round trip.
+	Extra map[string]interface{} `json:"-"`
 }
 
 type roleMapping struct {
 	RoleArn  string   `json:"rolearn,omitempty"`
 	Username string   `json:"username,omitempty"`
 	Groups   []string `json:"groups,omitempty"`
+	// Extra holds the fields of the entry this provider doesn't know about, so that they survive a round trip.
+	Extra map[string]interface{} `json:"-"`
+}
+
+func (u userMapping) MarshalJSON() ([]byte, error) {
+	type known userMapping
+	return marshalWithExtra(known(u), u.Extra)
+}
+
+func (u *userMapping) UnmarshalJSON(data []byte) error {
+	type known userMapping
+	extra, err := unmarshalWithExtra(data, (*known)(u), "userarn", "username", "groups")
+	u.Extra = extra
+	return err
+}
+
+func (r roleMapping) MarshalJSON() ([]byte, error) {
+	type known roleMapping
+	return marshalWithExtra(known(r), r.Extra)
+}
+
+func (r *roleMapping) UnmarshalJSON(data []byte) error {
+	type known roleMapping
+	extra, err := unmarshalWithExtra(data, (*known)(r), "rolearn", "username", "groups")
+	r.Extra = extra
+	return err
+}
+
+func marshalWithExtra(known interface{}, extra map[string]interface{}) ([]byte, error) {
+	data, err := json.Marshal(known)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+	fields := make(map[string]interface{})
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range extra {
+		if _, ok := fields[key]; !ok {
+			fields[key] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+func unmarshalWithExtra(data []byte, known interface{}, knownKeys ...string) (map[string]interface{}, error) {
+	err := json.Unmarshal(data, known)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range knownKeys {
+		delete(fields, key)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields, nil
 }
 
 func (i IamAuthMap) GetFromCluster(clientset *kubernetes.Clientset) (*IamAuthMap, error) {
@@ -111,22 +187,53 @@ func (i IamAuthMap) GetFromCluster(clientset *kubernetes.Clientset) (*IamAuthMap
 	if err != nil {
 		return nil, err
 	}
-	users := make([]userMapping, 0)
-	roles := make([]roleMapping, 0)
-	err = json.Unmarshal([]byte(auth.Data["mapUsers"]), &users)
+	authMap, err := i.fromData(auth.Data)
 	if err != nil {
-		log.Println(err.Error())
+		return nil, err
+	}
+	if _, ok := auth.Annotations[ownedArnsAnnotation]; ok {
+		authMap.Owned = make([]string, 0)
+		for identity := range ownedArns(auth.Annotations) {
+			authMap.Owned = append(authMap.Owned, identity)
+		}
 	}
-	err = json.Unmarshal([]byte(auth.Data["mapRoles"]), &roles)
+	return authMap, nil
+}
+
+// fromData parses the entries of the aws-auth ConfigMap. The entries are YAML, as written by eksctl and shown in the
+// EKS documentation; JSON, as written by earlier versions of this provider, is a subset of it. Entries that can't be
+// parsed are an error, as writing the ConfigMap back without them would drop the entries of other tools.
+func (i IamAuthMap) fromData(data map[string]string) (*IamAuthMap, error) {
+	i.MapUsers = make([]userMapping, 0)
+	i.MapRoles = make([]roleMapping, 0)
+	i.MapAccounts = make([]string, 0)
+	err := yaml.Unmarshal([]byte(data["mapUsers"]), &i.MapUsers)
 	if err != nil {
-		log.Println(err.Error())
+		return nil, fmt.Errorf("parsing mapUsers of the aws-auth ConfigMap: %v", err)
+	}
+	err = yaml.Unmarshal([]byte(data["mapRoles"]), &i.MapRoles)
+	if err != nil {
+		return nil, fmt.Errorf("parsing mapRoles of the aws-auth ConfigMap: %v", err)
+	}
+	// decoded straight into strings, which keeps the text of unquoted account IDs instead of reading them as numbers,
+	// octal ones included when they have a leading zero
+	err = yamlv2.Unmarshal([]byte(data["mapAccounts"]), &i.MapAccounts)
+	if err != nil {
+		return nil, fmt.Errorf("parsing mapAccounts of the aws-auth ConfigMap: %v", err)
+	}
+	if i.MapUsers == nil {
+		i.MapUsers = make([]userMapping, 0)
+	}
+	if i.MapRoles == nil {
+		i.MapRoles = make([]roleMapping, 0)
+	}
+	if i.MapAccounts == nil {
+		i.MapAccounts = make([]string, 0)
 	}
-	i.MapUsers = users
-	i.MapRoles = roles
 	return &i, nil
 }
 
-func (i IamAuthMap) addCaller(sess *session.Session) (*IamAuthMap, error) {
+func (i IamAuthMap) addCaller(sess *session.Session, model *Model) (*IamAuthMap, error) {
 	arn, err := getCaller(sts.New(sess))
 	if err != nil {
 		return nil, err
@@ -148,7 +255,7 @@ func (i IamAuthMap) addCaller(sess *session.Session) (*IamAuthMap, error) {
 	}
 	// add role for access of private clusters in VPC
 	i.MapRoles = append(i.MapRoles, roleMapping{
-		RoleArn: fmt.Sprintf("arn:%s:iam::%s:role/CloudFormation-Kubernetes-VPC", *partitionFromArn(arn), *accountIdFromArn(arn)),
+		RoleArn: *connectorRoleArn(arn, model),
 		Groups: []string{
 			"aws-auth-admin",
 		},
@@ -156,41 +263,137 @@ func (i IamAuthMap) addCaller(sess *session.Session) (*IamAuthMap, error) {
 	return &i, nil
 }
 
+// PushConfigMap writes the entries of the map to the aws-auth ConfigMap. Only the entries this resource owns, as
+// recorded in the ownership annotation by the previous push, are replaced or removed; entries added by other tools,
+// such as the node roles EKS maps for managed node groups or ones mapped by eksctl or other stacks, are left untouched.
 func (i IamAuthMap) PushConfigMap(clientset *kubernetes.Clientset) error {
-	data := map[string]string{}
-	if i.MapUsers != nil {
-		users, err := json.Marshal(i.MapUsers)
+	configMaps := clientset.CoreV1().ConfigMaps("kube-system")
+	ctx := context.Background()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		authConfigMap, err := configMaps.Get(ctx, "aws-auth", metav1.GetOptions{})
+		create := errors.IsNotFound(err)
+		if err != nil && !create {
+			return err
+		}
+		if create {
+			authConfigMap = &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "aws-auth",
+					Namespace: "kube-system",
+				},
+			}
+		}
+		current, err := IamAuthMap{}.fromData(authConfigMap.Data)
 		if err != nil {
 			return err
 		}
-		data["mapUsers"] = string(users)
-	}
-	if i.MapRoles != nil {
-		roles, err := json.Marshal(i.MapRoles)
+		merged := i.mergeInto(current, ownedArns(authConfigMap.Annotations))
+		if authConfigMap.Data == nil {
+			authConfigMap.Data = map[string]string{}
+		}
+		users, err := yaml.Marshal(merged.MapUsers)
+		if err != nil {
+			return err
+		}
+		authConfigMap.Data["mapUsers"] = string(users)
+		roles, err := yaml.Marshal(merged.MapRoles)
+		if err != nil {
+			return err
+		}
+		authConfigMap.Data["mapRoles"] = string(roles)
+		if _, ok := authConfigMap.Data["mapAccounts"]; ok || len(merged.MapAccounts) > 0 {
+			accounts, err := yaml.Marshal(merged.MapAccounts)
+			if err != nil {
+				return err
+			}
+			authConfigMap.Data["mapAccounts"] = string(accounts)
+		}
+		owned, err := json.Marshal(i.identities())
 		if err != nil {
 			return err
 		}
-		data["mapRoles"] = string(roles)
+		if authConfigMap.Annotations == nil {
+			authConfigMap.Annotations = map[string]string{}
+		}
+		authConfigMap.Annotations[ownedArnsAnnotation] = string(owned)
+		if create {
+			_, err = configMaps.Create(ctx, authConfigMap, metav1.CreateOptions{})
+		} else {
+			_, err = configMaps.Update(ctx, authConfigMap, metav1.UpdateOptions{})
+		}
+		return err
+	})
+}
+
+// mergeInto returns the entries of current that aren't owned by this resource, followed by the entries of the map,
+// which replace any entry for the same ARN or account.
+func (i IamAuthMap) mergeInto(current *IamAuthMap, owned map[string]bool) *IamAuthMap {
+	desired := make(map[string]bool)
+	for _, identity := range i.identities() {
+		desired[identity] = true
+	}
+	merged := &IamAuthMap{
+		MapUsers:    make([]userMapping, 0),
+		MapRoles:    make([]roleMapping, 0),
+		MapAccounts: make([]string, 0),
+	}
+	for _, user := range current.MapUsers {
+		if !owned[user.UserArn] && !desired[user.UserArn] {
+			merged.MapUsers = append(merged.MapUsers, user)
+		}
 	}
-	authConfigMap := &v1.ConfigMap{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "",
-			APIVersion: "",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name: "aws-auth",
-		},
-		Data: data,
+	merged.MapUsers = append(merged.MapUsers, i.MapUsers...)
+	for _, role := range current.MapRoles {
+		if !owned[role.RoleArn] && !desired[role.RoleArn] {
+			merged.MapRoles = append(merged.MapRoles, role)
+		}
 	}
-	ctx := context.Background()
-	_, err := clientset.CoreV1().ConfigMaps("kube-system").Update(ctx, authConfigMap, metav1.UpdateOptions{})
-	if errors.IsNotFound(err) {
-		_, err = clientset.CoreV1().ConfigMaps("kube-system").Create(ctx, authConfigMap, metav1.CreateOptions{})
+	merged.MapRoles = append(merged.MapRoles, i.MapRoles...)
+	for _, account := range current.MapAccounts {
+		if !owned[account] && !desired[account] {
+			merged.MapAccounts = append(merged.MapAccounts, account)
+		}
+	}
+	merged.MapAccounts = append(merged.MapAccounts, i.MapAccounts...)
+	return merged
+}
+
+// identities returns the user and role ARNs and the account IDs of the entries in the map.
+func (i IamAuthMap) identities() []string {
+	identities := make([]string, 0)
+	for _, user := range i.MapUsers {
+		identities = append(identities, user.UserArn)
+	}
+	for _, role := range i.MapRoles {
+		identities = append(identities, role.RoleArn)
 	}
+	return append(identities, i.MapAccounts...)
+}
+
+func ownedArns(annotations map[string]string) map[string]bool {
+	owned := make(map[string]bool)
+	value, ok := annotations[ownedArnsAnnotation]
+	if !ok {
+		return owned
+	}
+	var arns []string
+	err := json.Unmarshal([]byte(value), &arns)
+	if err != nil {
+		log.Println(err.Error())
+	}
+	for _, arn := range arns {
+		owned[arn] = true
+	}
+	return owned
+}
+
+// CreateInCluster creates the aws-auth-admin Role, RoleBinding and Group and the aws-auth ConfigMap.
+func (i IamAuthMap) CreateInCluster(clientset *kubernetes.Clientset) error {
+	err := putAwsAuthAdminRole(clientset)
 	if err != nil {
 		return err
 	}
-	return nil
+	return i.PushConfigMap(clientset)
 }
 
 func (i IamAuthMap) addFromModel(model *Model) *IamAuthMap {
@@ -224,6 +427,7 @@ func (i IamAuthMap) addFromModel(model *Model) *IamAuthMap {
 			i.MapRoles = append(i.MapRoles, role)
 		}
 	}
+	i.MapAccounts = append(i.MapAccounts, model.KubernetesApiAccess.Accounts...)
 	return &i
 }
 
@@ -298,19 +502,9 @@ func putAwsAuthAdminRole(clientset *kubernetes.Clientset) error {
 }
 
 func createIamAuth(sess *session.Session, svc eksiface.EKSAPI, model *Model) error {
-	// get kubernetes api client
-	clientset, err := CreateKubeClientEks(sess, svc, model.Name)
-	if err != nil {
-		return err
-	}
-	// add Role, RoleBinding and Group
-	err = putAwsAuthAdminRole(clientset)
-	if err != nil {
-		return err
-	}
 	// Add caller to authmap, so that we have permissions to perform updates to auth map.
 	authMap := &IamAuthMap{}
-	authMap, err = authMap.addCaller(sess)
+	authMap, err := authMap.addCaller(sess, model)
 	if err != nil {
 		return err
 	}
@@ -318,20 +512,27 @@ func createIamAuth(sess *session.Session, svc eksiface.EKSAPI, model *Model) err
 	// add iam entities from model
 	authMap = authMap.addFromModel(model)
 
-	// create aws-auth configmap
-	err = authMap.PushConfigMap(clientset)
+	if bootstrapsPrivately(model) {
+		resp, err := invokeLambda(sess, lambda.New(sess), model.Name, Event{AwsAuth: authMap, Action: CreateAction})
+		if err != nil {
+			return err
+		}
+		log.Println(resp)
+		return nil
+	}
+	// get kubernetes api client
+	clientset, err := CreateKubeClientEks(sess, svc, model.Name)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return authMap.CreateInCluster(clientset)
 }
 
 func updateIamAuth(sess *session.Session, svc eksiface.EKSAPI, model *Model) error {
 
 	// Add caller to authmap, so that we have permissions to perform updates to auth map.
 	authMap := &IamAuthMap{}
-	authMap, err := authMap.addCaller(sess)
+	authMap, err := authMap.addCaller(sess, model)
 	if err != nil {
 		return err
 	}
@@ -340,7 +541,7 @@ func updateIamAuth(sess *session.Session, svc eksiface.EKSAPI, model *Model) err
 	authMap = authMap.addFromModel(model)
 
 	if isPrivate(model) {
-		resp, err := invokeLambda(sess, lambda.New(sess), model.Name, authMap, UpdateAction)
+		resp, err := invokeLambda(sess, lambda.New(sess), model.Name, Event{AwsAuth: authMap, Action: UpdateAction})
 		if err != nil {
 			return err
 		}
@@ -359,3 +560,120 @@ func updateIamAuth(sess *session.Session, svc eksiface.EKSAPI, model *Model) err
 	}
 	return nil
 }
+
+// readIamAuth loads the aws-auth ConfigMap into the model's KubernetesApiAccess. Only the entries listed in the
+// ownership annotation are reported, leaving out the ones for the caller and the VPC connector role that the provider
+// adds itself. A ConfigMap without the annotation belongs to a cluster being imported; all of its entries are reported
+// then, except the node roles of managed node groups and the pod execution roles EKS maps for Fargate profiles. When
+// the ConfigMap can't be read, for example because the API server isn't reachable or the handler's role isn't mapped,
+// KubernetesApiAccess is left unset rather than failing the read.
+func readIamAuth(sess *session.Session, svc eksiface.EKSAPI, model *Model) error {
+	model.KubernetesApiAccess = nil
+	authMap, err := getIamAuth(sess, svc, model)
+	if err != nil {
+		log.Printf("Unable to read the aws-auth ConfigMap, KubernetesApiAccess is not reported: %v\n", err)
+		return nil
+	}
+	if authMap == nil {
+		return nil
+	}
+	caller, err := getCaller(sts.New(sess))
+	if err != nil {
+		return err
+	}
+	excluded := map[string]bool{
+		*caller:                          true,
+		*connectorRoleArn(caller, model): true,
+		// clusters created by earlier versions always have the default role mapped
+		*connectorRoleArn(caller, &Model{}): true,
+	}
+	if authMap.Owned == nil {
+		// the model only holds the Name when the cluster is imported, so the roles are taken from the cluster itself
+		nodeRoles, err := listNodeRoles(svc, model.Name)
+		if err != nil {
+			return err
+		}
+		podExecutionRoles, err := listPodExecutionRoles(svc, model.Name)
+		if err != nil {
+			return err
+		}
+		for _, role := range append(nodeRoles, podExecutionRoles...) {
+			excluded[role] = true
+		}
+	}
+	model.KubernetesApiAccess = authMap.apiAccess(excluded)
+	return nil
+}
+
+// apiAccess returns the entries of the map that are owned, or all of them when ownership isn't known, except the
+// excluded ones. Nil is returned when no entry remains.
+func (i IamAuthMap) apiAccess(excluded map[string]bool) *KubernetesApiAccess {
+	var owned map[string]bool
+	if i.Owned != nil {
+		owned = make(map[string]bool)
+		for _, identity := range i.Owned {
+			owned[identity] = true
+		}
+	}
+	reported := func(identity string) bool {
+		return !excluded[identity] && (owned == nil || owned[identity])
+	}
+	access := &KubernetesApiAccess{}
+	for _, u := range i.MapUsers {
+		if reported(u.UserArn) {
+			access.Users = append(access.Users, makeKubernetesApiAccessEntry(u.UserArn, u.Username, u.Groups))
+		}
+	}
+	for _, r := range i.MapRoles {
+		if reported(r.RoleArn) {
+			access.Roles = append(access.Roles, makeKubernetesApiAccessEntry(r.RoleArn, r.Username, r.Groups))
+		}
+	}
+	for _, account := range i.MapAccounts {
+		if reported(account) {
+			access.Accounts = append(access.Accounts, account)
+		}
+	}
+	if len(access.Users) == 0 && len(access.Roles) == 0 && len(access.Accounts) == 0 {
+		return nil
+	}
+	return access
+}
+
+// getIamAuth reads the aws-auth ConfigMap, through the VPC connector function for private clusters. Nil is returned
+// when the ConfigMap or the function doesn't exist.
+func getIamAuth(sess *session.Session, svc eksiface.EKSAPI, model *Model) (*IamAuthMap, error) {
+	if isPrivate(model) {
+		lambdaSvc := lambda.New(sess)
+		_, err := lambdaSvc.GetFunction(&lambda.GetFunctionInput{FunctionName: aws.String(FunctionNamePrefix + *model.Name)})
+		if err != nil {
+			if matchesAwsErrorCode(err, lambda.ErrCodeResourceNotFoundException) {
+				// imported clusters may have no VPC connector function to read through
+				log.Printf("No VPC connector function for cluster %v\n", *model.Name)
+				return nil, nil
+			}
+			return nil, err
+		}
+		return invokeLambda(sess, lambdaSvc, model.Name, Event{AwsAuth: &IamAuthMap{}, Action: ReadAction})
+	}
+	clientset, err := CreateKubeClientEks(sess, svc, model.Name)
+	if err != nil {
+		return nil, err
+	}
+	authMap, err := IamAuthMap{}.GetFromCluster(clientset)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	return authMap, err
+}
+
+func makeKubernetesApiAccessEntry(arn string, username string, groups []string) KubernetesApiAccessEntry {
+	entry := KubernetesApiAccessEntry{
+		Arn:    aws.String(arn),
+		Groups: groups,
+	}
+	if username != "" {
+		entry.Username = aws.String(username)
+	}
+	return entry
+}
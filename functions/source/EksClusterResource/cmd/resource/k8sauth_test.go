@@ -0,0 +1,220 @@
+package resource
+
+import (
+	"encoding/json"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMergeInto(t *testing.T) {
+	nodeRole := roleMapping{
+		RoleArn:  "arn:aws:iam::123456789012:role/node",
+		Username: "system:node:{{EC2PrivateDNSName}}",
+		Groups:   []string{"system:bootstrappers", "system:nodes"},
+	}
+	admin := roleMapping{RoleArn: "arn:aws:iam::123456789012:role/admin", Groups: []string{"system:masters"}}
+	viewer := roleMapping{RoleArn: "arn:aws:iam::123456789012:role/viewer", Groups: []string{"view"}}
+	user := userMapping{UserArn: "arn:aws:iam::123456789012:user/dev", Groups: []string{"edit"}}
+	tests := map[string]struct {
+		desired  IamAuthMap
+		current  IamAuthMap
+		owned    map[string]bool
+		expected IamAuthMap
+	}{
+		"keeps entries it doesn't own": {
+			desired: IamAuthMap{MapRoles: []roleMapping{admin}},
+			current: IamAuthMap{MapRoles: []roleMapping{nodeRole}, MapUsers: []userMapping{user}, MapAccounts: []string{"012345678901"}},
+			owned:   map[string]bool{},
+			expected: IamAuthMap{
+				MapRoles:    []roleMapping{nodeRole, admin},
+				MapUsers:    []userMapping{user},
+				MapAccounts: []string{"012345678901"},
+			},
+		},
+		"removes owned entries no longer desired": {
+			desired: IamAuthMap{MapRoles: []roleMapping{admin}},
+			current: IamAuthMap{MapRoles: []roleMapping{nodeRole, admin, viewer}, MapUsers: []userMapping{user}, MapAccounts: []string{"012345678901"}},
+			owned:   map[string]bool{admin.RoleArn: true, viewer.RoleArn: true, user.UserArn: true, "012345678901": true},
+			expected: IamAuthMap{
+				MapRoles:    []roleMapping{nodeRole, admin},
+				MapUsers:    []userMapping{},
+				MapAccounts: []string{},
+			},
+		},
+		"replaces entries for the same ARN": {
+			desired: IamAuthMap{MapRoles: []roleMapping{{RoleArn: viewer.RoleArn, Groups: []string{"edit"}}}},
+			current: IamAuthMap{MapRoles: []roleMapping{viewer, nodeRole}},
+			owned:   map[string]bool{},
+			expected: IamAuthMap{
+				MapRoles:    []roleMapping{nodeRole, {RoleArn: viewer.RoleArn, Groups: []string{"edit"}}},
+				MapUsers:    []userMapping{},
+				MapAccounts: []string{},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			merged := tc.desired.mergeInto(&tc.current, tc.owned)
+			if !reflect.DeepEqual(*merged, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, *merged)
+			}
+		})
+	}
+}
+
+func TestFromDataAccounts(t *testing.T) {
+	tests := map[string]struct {
+		mapAccounts string
+		expected    []string
+	}{
+		"quoted": {
+			mapAccounts: "- \"012345678901\"\n",
+			expected:    []string{"012345678901"},
+		},
+		"unquoted": {
+			mapAccounts: "- 123456789012\n",
+			expected:    []string{"123456789012"},
+		},
+		"unquoted with leading zero and octal digits": {
+			mapAccounts: "- 012345670123\n",
+			expected:    []string{"012345670123"},
+		},
+		"json": {
+			mapAccounts: `["012345678901", "123456789012"]`,
+			expected:    []string{"012345678901", "123456789012"},
+		},
+		"missing": {
+			expected: []string{},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data := map[string]string{}
+			if tc.mapAccounts != "" {
+				data["mapAccounts"] = tc.mapAccounts
+			}
+			authMap, err := IamAuthMap{}.fromData(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			accounts := authMap.MapAccounts
+			if !reflect.DeepEqual(accounts, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, accounts)
+			}
+		})
+	}
+}
+
+// awsAuthServer serves the given aws-auth ConfigMap data and records the requests that would change it.
+func awsAuthServer(t *testing.T, data map[string]string, writes *[]string) *kubernetes.Clientset {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			*writes = append(*writes, r.Method+" "+r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]string{"name": "aws-auth", "namespace": "kube-system"},
+			"data":       data,
+		})
+	}))
+	t.Cleanup(server.Close)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientset
+}
+
+func TestPushConfigMap(t *testing.T) {
+	tests := map[string]struct {
+		data   map[string]string
+		pushed bool
+	}{
+		"valid entries": {
+			data:   map[string]string{"mapRoles": "- rolearn: arn:aws:iam::123456789012:role/node\n  groups:\n  - system:nodes\n"},
+			pushed: true,
+		},
+		"malformed mapRoles": {
+			data: map[string]string{"mapRoles": "- rolearn: arn:aws:iam::123456789012:role/node\n  groups: [system:nodes\n"},
+		},
+		"mapRoles that isn't a list": {
+			data: map[string]string{"mapRoles": "rolearn: arn:aws:iam::123456789012:role/node\n"},
+		},
+		"malformed mapUsers": {
+			data: map[string]string{"mapUsers": "- userarn: [\n"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var writes []string
+			clientset := awsAuthServer(t, tc.data, &writes)
+			desired := IamAuthMap{MapRoles: []roleMapping{{RoleArn: "arn:aws:iam::123456789012:role/admin", Groups: []string{"system:masters"}}}}
+			err := desired.PushConfigMap(clientset)
+			if tc.pushed && (err != nil || len(writes) != 1) {
+				t.Errorf("expected the ConfigMap to be pushed, got %v after %v", err, writes)
+			}
+			if !tc.pushed && (err == nil || len(writes) != 0) {
+				t.Errorf("expected an error without pushing, got %v after %v", err, writes)
+			}
+		})
+	}
+}
+
+func TestApiAccess(t *testing.T) {
+	caller := "arn:aws:iam::123456789012:role/deployer"
+	admin := "arn:aws:iam::123456789012:role/admin"
+	foreign := "arn:aws:iam::123456789012:role/eksctl"
+	node := "arn:aws:iam::123456789012:role/node"
+	authMap := IamAuthMap{
+		MapRoles:    []roleMapping{{RoleArn: caller}, {RoleArn: admin}, {RoleArn: foreign}, {RoleArn: node}},
+		MapAccounts: []string{"012345678901", "123456789012"},
+	}
+	tests := map[string]struct {
+		owned    []string
+		excluded map[string]bool
+		roles    []string
+		accounts []string
+	}{
+		"only owned entries": {
+			owned:    []string{caller, admin, "012345678901"},
+			excluded: map[string]bool{caller: true},
+			roles:    []string{admin},
+			accounts: []string{"012345678901"},
+		},
+		"owned entries removed since": {
+			owned:    []string{caller, "arn:aws:iam::123456789012:role/removed"},
+			excluded: map[string]bool{caller: true},
+		},
+		"import without annotation": {
+			excluded: map[string]bool{caller: true, node: true},
+			roles:    []string{admin, foreign},
+			accounts: []string{"012345678901", "123456789012"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			i := authMap
+			i.Owned = tc.owned
+			access := i.apiAccess(tc.excluded)
+			if tc.roles == nil && tc.accounts == nil {
+				if access != nil {
+					t.Errorf("expected no access to be reported, got %+v", access)
+				}
+				return
+			}
+			var roles []string
+			for _, role := range access.Roles {
+				roles = append(roles, *role.Arn)
+			}
+			if !reflect.DeepEqual(roles, tc.roles) || !reflect.DeepEqual(access.Accounts, tc.accounts) {
+				t.Errorf("expected roles %v and accounts %v, got %v and %v", tc.roles, tc.accounts, roles, access.Accounts)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"log"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+const (
+	kubeConfigSecretPrefix = "eks-kubeconfig-"
+	// names the cluster a kubeconfig secret was created for, secrets without it are never written or deleted
+	kubeConfigOwnerTag = "awsqs.eks/cluster"
+)
+
+type kubeConfig struct {
+	ApiVersion     string              `json:"apiVersion"`
+	Kind           string              `json:"kind"`
+	Clusters       []kubeConfigCluster `json:"clusters"`
+	Contexts       []kubeConfigContext `json:"contexts"`
+	CurrentContext string              `json:"current-context"`
+	Users          []kubeConfigUser    `json:"users"`
+}
+
+type kubeConfigCluster struct {
+	Name    string `json:"name"`
+	Cluster struct {
+		Server                   string `json:"server"`
+		CertificateAuthorityData string `json:"certificate-authority-data"`
+	} `json:"cluster"`
+}
+
+type kubeConfigContext struct {
+	Name    string `json:"name"`
+	Context struct {
+		Cluster string `json:"cluster"`
+		User    string `json:"user"`
+	} `json:"context"`
+}
+
+type kubeConfigUser struct {
+	Name string `json:"name"`
+	User struct {
+		Exec struct {
+			ApiVersion string   `json:"apiVersion"`
+			Command    string   `json:"command"`
+			Args       []string `json:"args"`
+		} `json:"exec"`
+	} `json:"user"`
+}
+
+func exportsKubeConfig(model *Model) bool {
+	return model.KubeConfig != nil
+}
+
+func kubeConfigSecretName(model *Model) *string {
+	if model.KubeConfig != nil && model.KubeConfig.SecretName != nil {
+		return model.KubeConfig.SecretName
+	}
+	return aws.String(kubeConfigSecretPrefix + *model.Name)
+}
+
+// makeKubeConfig renders a kubeconfig for the cluster that authenticates through `aws eks get-token`, optionally
+// assuming the role given in the model.
+func makeKubeConfig(cluster *eks.Cluster, model *Model) ([]byte, error) {
+	name := *cluster.Arn
+	region := strings.Split(name, ":")[3]
+	args := []string{"--region", region, "eks", "get-token", "--cluster-name", *cluster.Name}
+	if model.KubeConfig.RoleArn != nil {
+		args = append(args, "--role-arn", *model.KubeConfig.RoleArn)
+	}
+	config := kubeConfig{
+		ApiVersion:     "v1",
+		Kind:           "Config",
+		CurrentContext: name,
+		Clusters:       make([]kubeConfigCluster, 1),
+		Contexts:       make([]kubeConfigContext, 1),
+		Users:          make([]kubeConfigUser, 1),
+	}
+	config.Clusters[0].Name = name
+	config.Clusters[0].Cluster.Server = aws.StringValue(cluster.Endpoint)
+	if cluster.CertificateAuthority != nil {
+		config.Clusters[0].Cluster.CertificateAuthorityData = aws.StringValue(cluster.CertificateAuthority.Data)
+	}
+	config.Contexts[0].Name = name
+	config.Contexts[0].Context.Cluster = name
+	config.Contexts[0].Context.User = name
+	config.Users[0].Name = name
+	config.Users[0].User.Exec.ApiVersion = "client.authentication.k8s.io/v1beta1"
+	config.Users[0].User.Exec.Command = "aws"
+	config.Users[0].User.Exec.Args = args
+	return yaml.Marshal(config)
+}
+
+// putKubeConfigSecret writes the kubeconfig of the cluster to the secret owned by the resource, creating the secret
+// if it doesn't exist and storing a new version only when the endpoint, CA data or role changed. A secret of that name
+// that isn't tagged as owned by the cluster is reported as an error, and an owned secret pending deletion is restored.
+func putKubeConfigSecret(svc secretsmanageriface.SecretsManagerAPI, eksSvc eksiface.EKSAPI, model *Model) error {
+	response, err := eksSvc.DescribeCluster(&eks.DescribeClusterInput{Name: model.Name})
+	if err != nil {
+		return err
+	}
+	config, err := makeKubeConfig(response.Cluster, model)
+	if err != nil {
+		return err
+	}
+	name := kubeConfigSecretName(model)
+	secret, err := svc.DescribeSecret(&secretsmanager.DescribeSecretInput{SecretId: name})
+	if err != nil {
+		if !matchesAwsErrorCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+			return err
+		}
+		log.Printf("Creating kubeconfig secret %v...\n", *name)
+		input := &secretsmanager.CreateSecretInput{
+			Name:         name,
+			Description:  aws.String("kubeconfig for EKS cluster " + *model.Name),
+			SecretString: aws.String(string(config)),
+			Tags:         []*secretsmanager.Tag{{Key: aws.String(kubeConfigOwnerTag), Value: model.Name}},
+		}
+		for _, tag := range model.Tags {
+			input.Tags = append(input.Tags, &secretsmanager.Tag{Key: tag.Key, Value: tag.Value})
+		}
+		created, err := svc.CreateSecret(input)
+		if err != nil {
+			if matchesAwsErrorCode(err, secretsmanager.ErrCodeResourceExistsException) {
+				return invalidRequestError(fmt.Sprintf("secret %v already exists, set KubeConfig SecretName to a different name", *name))
+			}
+			return err
+		}
+		model.KubeConfigSecretArn = created.ARN
+		return nil
+	}
+	if !ownsKubeConfigSecret(secret, model) {
+		return invalidRequestError(fmt.Sprintf("secret %v already exists and was not created for cluster %v, "+
+			"set KubeConfig SecretName to a different name", *name, *model.Name))
+	}
+	if secret.DeletedDate != nil {
+		log.Printf("Restoring kubeconfig secret %v...\n", *name)
+		_, err = svc.RestoreSecret(&secretsmanager.RestoreSecretInput{SecretId: name})
+		if err != nil {
+			return err
+		}
+	}
+	model.KubeConfigSecretArn = secret.ARN
+	current, err := svc.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: name})
+	if err != nil {
+		return err
+	}
+	if aws.StringValue(current.SecretString) == string(config) {
+		return nil
+	}
+	log.Printf("Updating kubeconfig secret %v...\n", *name)
+	_, err = svc.PutSecretValue(&secretsmanager.PutSecretValueInput{
+		SecretId:     name,
+		SecretString: aws.String(string(config)),
+	})
+	return err
+}
+
+func ownsKubeConfigSecret(secret *secretsmanager.DescribeSecretOutput, model *Model) bool {
+	for _, tag := range secret.Tags {
+		if aws.StringValue(tag.Key) == kubeConfigOwnerTag {
+			return aws.StringValue(tag.Value) == *model.Name
+		}
+	}
+	return false
+}
+
+func readKubeConfigSecret(svc secretsmanageriface.SecretsManagerAPI, model *Model) error {
+	response, err := svc.DescribeSecret(&secretsmanager.DescribeSecretInput{SecretId: kubeConfigSecretName(model)})
+	if err != nil {
+		if matchesAwsErrorCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+			model.KubeConfigSecretArn = nil
+			return nil
+		}
+		return err
+	}
+	model.KubeConfigSecretArn = nil
+	if ownsKubeConfigSecret(response, model) && response.DeletedDate == nil {
+		model.KubeConfigSecretArn = response.ARN
+	}
+	return nil
+}
+
+// deleteKubeConfigSecret schedules the kubeconfig secret for deletion, keeping the recovery window so that it can
+// still be restored, unless the secret wasn't created for the cluster.
+func deleteKubeConfigSecret(svc secretsmanageriface.SecretsManagerAPI, model *Model) error {
+	name := kubeConfigSecretName(model)
+	secret, err := svc.DescribeSecret(&secretsmanager.DescribeSecretInput{SecretId: name})
+	if err != nil {
+		if matchesAwsErrorCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+			model.KubeConfigSecretArn = nil
+			return nil
+		}
+		return err
+	}
+	if !ownsKubeConfigSecret(secret, model) {
+		log.Printf("Leaving secret %v, which was not created for cluster %v\n", *name, *model.Name)
+		model.KubeConfigSecretArn = nil
+		return nil
+	}
+	if secret.DeletedDate == nil {
+		log.Printf("Deleting kubeconfig secret %v...\n", *name)
+		_, err = svc.DeleteSecret(&secretsmanager.DeleteSecretInput{SecretId: name})
+		if err != nil && !matchesAwsErrorCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+			return err
+		}
+	}
+	model.KubeConfigSecretArn = nil
+	return nil
+}
@@ -0,0 +1,79 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"testing"
+)
+
+type mockSecretsManagerClient struct {
+	secretsmanageriface.SecretsManagerAPI
+	secret  *secretsmanager.DescribeSecretOutput
+	deletes []*secretsmanager.DeleteSecretInput
+	puts    int
+}
+
+func (m *mockSecretsManagerClient) DescribeSecret(*secretsmanager.DescribeSecretInput) (*secretsmanager.DescribeSecretOutput, error) {
+	return m.secret, nil
+}
+
+func (m *mockSecretsManagerClient) GetSecretValue(*secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String("")}, nil
+}
+
+func (m *mockSecretsManagerClient) PutSecretValue(*secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+	m.puts++
+	return &secretsmanager.PutSecretValueOutput{}, nil
+}
+
+func (m *mockSecretsManagerClient) DeleteSecret(input *secretsmanager.DeleteSecretInput) (*secretsmanager.DeleteSecretOutput, error) {
+	m.deletes = append(m.deletes, input)
+	return &secretsmanager.DeleteSecretOutput{}, nil
+}
+
+func secretTaggedWith(key string, value string) *secretsmanager.DescribeSecretOutput {
+	return &secretsmanager.DescribeSecretOutput{
+		ARN:  aws.String("arn:aws:secretsmanager:us-east-1:123456789012:secret:eks-kubeconfig-cluster-AbCdEf"),
+		Tags: []*secretsmanager.Tag{{Key: aws.String(key), Value: aws.String(value)}},
+	}
+}
+
+func TestKubeConfigSecretOwnership(t *testing.T) {
+	tests := map[string]struct {
+		secret *secretsmanager.DescribeSecretOutput
+		owned  bool
+	}{
+		"created for the cluster":      {secret: secretTaggedWith(kubeConfigOwnerTag, "cluster"), owned: true},
+		"created for another cluster":  {secret: secretTaggedWith(kubeConfigOwnerTag, "other")},
+		"created outside the resource": {secret: secretTaggedWith("team", "platform")},
+	}
+	cluster := &eks.Cluster{
+		Name:     aws.String("cluster"),
+		Arn:      aws.String("arn:aws:eks:us-east-1:123456789012:cluster/cluster"),
+		Endpoint: aws.String("https://example.eks.amazonaws.com"),
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockSecretsManagerClient{secret: tc.secret}
+			model := &Model{Name: aws.String("cluster"), KubeConfig: &KubeConfig{}}
+			err := putKubeConfigSecret(svc, &mockEKSClient{cluster: cluster}, model)
+			if tc.owned && (err != nil || svc.puts != 1) {
+				t.Errorf("expected the secret to be updated, got %v after %v puts", err, svc.puts)
+			}
+			if !tc.owned && (err == nil || svc.puts != 0) {
+				t.Errorf("expected an error without updating the secret, got %v after %v puts", err, svc.puts)
+			}
+			if err := deleteKubeConfigSecret(svc, model); err != nil {
+				t.Fatal(err)
+			}
+			if deleted := len(svc.deletes) > 0; deleted != tc.owned {
+				t.Fatalf("expected deleted to be %v, got %v", tc.owned, deleted)
+			}
+			if tc.owned && svc.deletes[0].ForceDeleteWithoutRecovery != nil {
+				t.Errorf("expected the secret to keep its recovery window")
+			}
+		})
+	}
+}
@@ -9,16 +9,21 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/aws/aws-sdk-go/service/eks"
 	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"io/ioutil"
 	"log"
+	"reflect"
+	"strings"
 )
 
 const (
 	ZipFile            string = "k8svpc.zip"
+	Arm64ZipFile       string = "k8svpc-arm64.zip"
 	FunctionNamePrefix string = "k8s-api-vpc-connector-"
 	Handler            string = "bootstrap"
 	MemorySize         int64  = 256
@@ -26,12 +31,29 @@ const (
 	Timeout            int64  = 900
 )
 
+// connectorConfig is the configuration of the VPC connector function: the VpcConnector settings of the model with
+// defaults applied.
+type connectorConfig struct {
+	RoleArn          *string
+	MemorySize       int64
+	Timeout          int64
+	Architecture     string
+	SecurityGroupIds []string
+	SubnetIds        []string
+	Environment      map[string]string
+}
+
 type Event struct {
 	ClusterName *string     `json:"clustername,omitempty"`
 	Endpoint    *string     `json:"endpoint,omitempty"`
 	CaData      []byte      `json:"cadata,omitempty"`
 	AwsAuth     *IamAuthMap `json:"apiaccess,omitempty"`
 	Action      Action      `json:"action,omitempty"`
+	// Token authenticates the function as the handler's caller, which is the only principal with access to the
+	// cluster until the aws-auth ConfigMap exists. It is only sent with the Create action and must never be logged.
+	Token *string `json:"token,omitempty"`
+	// Manifests holds the YAML manifests to server-side apply for the Apply action.
+	Manifests []string `json:"manifests,omitempty"`
 }
 
 //Status represents the status of the handler.
@@ -43,6 +65,7 @@ const (
 	UpdateAction Action = "Update"
 	DeleteAction Action = "Delete"
 	ListAction   Action = "List"
+	ApplyAction  Action = "Apply"
 )
 
 type OperationComplete bool
@@ -61,22 +84,15 @@ func putFunction(sess *session.Session, model *Model, reInvoke bool) (OperationC
 	if err != nil {
 		return Complete, err
 	}
-	accId := accountIdFromArn(caller)
-	partition := partitionFromArn(caller)
-	var rolename string
-	if model.LambdaRoleName == nil {
-		rolename = "CloudFormation-Kubernetes-VPC"
-	} else {
-		rolename = *model.LambdaRoleName
-	}
-	roleArn := aws.String("arn:" + *partition + ":iam::" + *accId + ":role/" + rolename)
+	roleArn := connectorRoleArn(caller, model)
 
 	clusterName := model.Name
-	vpcConfig := *model.ResourcesVpcConfig
-	err = updateFunction(svc, roleArn, clusterName, vpcConfig)
+	config := makeConnectorConfig(model, roleArn)
+	tags := tagsToMap(model.Tags)
+	err = updateFunction(svc, clusterName, config, tags)
 	if err != nil {
 		if functionNotExists(err) {
-			err = createFunction(svc, roleArn, clusterName, vpcConfig)
+			err = createFunction(svc, clusterName, config, tags)
 			if err != nil {
 				return Complete, err
 			}
@@ -87,6 +103,47 @@ func putFunction(sess *session.Session, model *Model, reInvoke bool) (OperationC
 	return stabilizeFunction(svc, model, aws.String(FunctionNamePrefix+*model.Name))
 }
 
+func makeConnectorConfig(model *Model, roleArn *string) connectorConfig {
+	config := connectorConfig{
+		RoleArn:          roleArn,
+		MemorySize:       MemorySize,
+		Timeout:          Timeout,
+		Architecture:     lambda.ArchitectureX8664,
+		SecurityGroupIds: model.ResourcesVpcConfig.SecurityGroupIds,
+		SubnetIds:        model.ResourcesVpcConfig.SubnetIds,
+	}
+	connector := model.VpcConnector
+	if connector == nil {
+		return config
+	}
+	if connector.MemorySize != nil {
+		config.MemorySize = int64(*connector.MemorySize)
+	}
+	if connector.Timeout != nil {
+		config.Timeout = int64(*connector.Timeout)
+	}
+	if connector.Architecture != nil {
+		config.Architecture = *connector.Architecture
+	}
+	config.SecurityGroupIds = append([]string{}, config.SecurityGroupIds...)
+	for _, id := range connector.SecurityGroupIds {
+		if !containsString(config.SecurityGroupIds, id) {
+			config.SecurityGroupIds = append(config.SecurityGroupIds, id)
+		}
+	}
+	if len(connector.SubnetIds) > 0 {
+		config.SubnetIds = connector.SubnetIds
+	}
+	config.Environment = connector.Environment
+	return config
+}
+
+// roleNotAssumable reports whether Lambda rejected the function's role because it can't assume it yet, which happens
+// for a short while after the role is created.
+func roleNotAssumable(err error) bool {
+	return matchesAwsErrorCode(err, lambda.ErrCodeInvalidParameterValueException) && strings.Contains(err.Error(), "cannot be assumed")
+}
+
 func functionNotExists(err error) bool {
 	if aerr, ok := err.(awserr.Error); ok {
 		return aerr.Code() == lambda.ErrCodeResourceNotFoundException
@@ -94,27 +151,34 @@ func functionNotExists(err error) bool {
 	return false
 }
 
-func createFunction(svc lambdaiface.LambdaAPI, roleArn *string, clusterName *string, vpcConfig ResourcesVpcConfig) error {
-	zip, _, err := getZip()
+func createFunction(svc lambdaiface.LambdaAPI, clusterName *string, config connectorConfig, tags map[string]string) error {
+	zip, _, err := getZip(config.Architecture)
 	if err != nil {
 		return err
 	}
 	funcName := FunctionNamePrefix + *clusterName
 	input := &lambda.CreateFunctionInput{
+		Architectures: aws.StringSlice([]string{config.Architecture}),
 		Code: &lambda.FunctionCode{
 			ZipFile: zip,
 		},
 		FunctionName: aws.String(funcName),
 		Handler:      aws.String(Handler),
-		MemorySize:   aws.Int64(MemorySize),
-		Role:         roleArn,
+		MemorySize:   aws.Int64(config.MemorySize),
+		Role:         config.RoleArn,
 		Runtime:      aws.String(Runtime),
-		Timeout:      aws.Int64(Timeout),
+		Timeout:      aws.Int64(config.Timeout),
 		VpcConfig: &lambda.VpcConfig{
-			SecurityGroupIds: aws.StringSlice(vpcConfig.SecurityGroupIds),
-			SubnetIds:        aws.StringSlice(vpcConfig.SubnetIds),
+			SecurityGroupIds: aws.StringSlice(config.SecurityGroupIds),
+			SubnetIds:        aws.StringSlice(config.SubnetIds),
 		},
 	}
+	if len(config.Environment) > 0 {
+		input.Environment = &lambda.Environment{Variables: aws.StringMap(config.Environment)}
+	}
+	if len(tags) > 0 {
+		input.Tags = aws.StringMap(tags)
+	}
 	_, err = svc.CreateFunction(input)
 	// Resource already exists error is fine
 	if awsErr, ok := err.(awserr.Error); ok {
@@ -126,9 +190,14 @@ func createFunction(svc lambdaiface.LambdaAPI, roleArn *string, clusterName *str
 	return err
 }
 
-func getZip() ([]byte, string, error) {
+// getZip returns the connector function package built for architecture and its base64 encoded SHA-256 hash.
+func getZip(architecture string) ([]byte, string, error) {
+	file := ZipFile
+	if architecture == lambda.ArchitectureArm64 {
+		file = Arm64ZipFile
+	}
 	hasher := sha256.New()
-	s, err := ioutil.ReadFile(ZipFile)
+	s, err := ioutil.ReadFile(file)
 	hasher.Write(s)
 	if err != nil {
 		return nil, "", err
@@ -136,44 +205,106 @@ func getZip() ([]byte, string, error) {
 	return s, base64.StdEncoding.EncodeToString(hasher.Sum(nil)), nil
 }
 
-func updateFunction(svc lambdaiface.LambdaAPI, roleArn *string, clusterName *string, vpcConfig ResourcesVpcConfig) error {
-	zip, hash, err := getZip()
+// updateFunction brings the code and configuration of the existing connector function in line with config. Each is
+// only updated when it differs, so repeated invocations don't start new function updates.
+func updateFunction(svc lambdaiface.LambdaAPI, clusterName *string, config connectorConfig, tags map[string]string) error {
+	zip, hash, err := getZip(config.Architecture)
 	if err != nil {
 		return err
 	}
-	functionOutput, err := svc.GetFunction(&lambda.GetFunctionInput{FunctionName: aws.String(FunctionNamePrefix + *clusterName)})
+	funcName := aws.String(FunctionNamePrefix + *clusterName)
+	functionOutput, err := svc.GetFunction(&lambda.GetFunctionInput{FunctionName: funcName})
 	if err != nil {
 		return err
 	}
-	if hash != *functionOutput.Configuration.CodeSha256 {
+	current := functionOutput.Configuration
+	if hash != aws.StringValue(current.CodeSha256) || !containsString(aws.StringValueSlice(current.Architectures), config.Architecture) {
+		log.Printf("Updating code of function %v...\n", *funcName)
 		codeInput := &lambda.UpdateFunctionCodeInput{
-			FunctionName: aws.String(FunctionNamePrefix + *clusterName),
-			ZipFile:      zip,
+			Architectures: aws.StringSlice([]string{config.Architecture}),
+			FunctionName:  funcName,
+			ZipFile:       zip,
 		}
 		_, err = svc.UpdateFunctionCode(codeInput)
 		if err != nil {
 			return err
 		}
 	}
-	configInput := &lambda.UpdateFunctionConfigurationInput{
-		FunctionName: aws.String(FunctionNamePrefix + *clusterName),
-		Handler:      aws.String(Handler),
-		MemorySize:   aws.Int64(MemorySize),
-		Role:         roleArn,
-		Runtime:      aws.String(Runtime),
-		Timeout:      aws.Int64(Timeout),
-		VpcConfig: &lambda.VpcConfig{
-			SecurityGroupIds: aws.StringSlice(vpcConfig.SecurityGroupIds),
-			SubnetIds:        aws.StringSlice(vpcConfig.SubnetIds),
-		},
+	if functionConfigChanged(current, config) {
+		// Lambda rejects configuration updates while an update of the code or the configuration is in progress
+		err = svc.WaitUntilFunctionUpdatedV2(&lambda.GetFunctionInput{FunctionName: funcName})
+		if err != nil {
+			return err
+		}
+		log.Printf("Updating configuration of function %v...\n", *funcName)
+		configInput := &lambda.UpdateFunctionConfigurationInput{
+			Environment:  &lambda.Environment{Variables: aws.StringMap(config.Environment)},
+			FunctionName: funcName,
+			Handler:      aws.String(Handler),
+			MemorySize:   aws.Int64(config.MemorySize),
+			Role:         config.RoleArn,
+			Runtime:      aws.String(Runtime),
+			Timeout:      aws.Int64(config.Timeout),
+			VpcConfig: &lambda.VpcConfig{
+				SecurityGroupIds: aws.StringSlice(config.SecurityGroupIds),
+				SubnetIds:        aws.StringSlice(config.SubnetIds),
+			},
+		}
+		_, err = svc.UpdateFunctionConfiguration(configInput)
+		if err != nil {
+			return err
+		}
 	}
+	return updateFunctionTags(svc, current.FunctionArn, tags)
+}
+
+func functionConfigChanged(current *lambda.FunctionConfiguration, config connectorConfig) bool {
+	if aws.StringValue(current.Role) != aws.StringValue(config.RoleArn) ||
+		aws.StringValue(current.Handler) != Handler ||
+		aws.StringValue(current.Runtime) != Runtime ||
+		aws.Int64Value(current.MemorySize) != config.MemorySize ||
+		aws.Int64Value(current.Timeout) != config.Timeout {
+		return true
+	}
+	vpcConfig := &lambda.VpcConfigResponse{}
+	if current.VpcConfig != nil {
+		vpcConfig = current.VpcConfig
+	}
+	// slicesEqual sorts its arguments, so compare copies
+	if !slicesEqual(aws.StringValueSlice(vpcConfig.SecurityGroupIds), append([]string{}, config.SecurityGroupIds...)) ||
+		!slicesEqual(aws.StringValueSlice(vpcConfig.SubnetIds), append([]string{}, config.SubnetIds...)) {
+		return true
+	}
+	var variables map[string]string
+	if current.Environment != nil {
+		variables = aws.StringValueMap(current.Environment.Variables)
+	}
+	if len(variables) == 0 && len(config.Environment) == 0 {
+		return false
+	}
+	return !reflect.DeepEqual(variables, config.Environment)
+}
 
-	_, err = svc.UpdateFunctionConfiguration(configInput)
+func updateFunctionTags(svc lambdaiface.LambdaAPI, functionArn *string, tags map[string]string) error {
+	tagsOutput, err := svc.ListTags(&lambda.ListTagsInput{Resource: functionArn})
+	if err != nil {
+		return err
+	}
+	added, removed := diffTags(aws.StringValueMap(tagsOutput.Tags), tags)
+	if len(removed) > 0 {
+		_, err = svc.UntagResource(&lambda.UntagResourceInput{Resource: functionArn, TagKeys: removed})
+		if err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 {
+		_, err = svc.TagResource(&lambda.TagResourceInput{Resource: functionArn, Tags: added})
+	}
 	return err
 }
 
-func deleteFunction(sess *session.Session, model *Model, callbackContext map[string]interface{}) error {
-	if callbackContext != nil || model.Name == nil {
+func deleteFunction(sess *session.Session, model *Model) error {
+	if model.Name == nil {
 		return nil
 	}
 	svc := lambda.New(sess)
@@ -190,6 +321,46 @@ func deleteFunction(sess *session.Session, model *Model, callbackContext map[str
 	return err
 }
 
+// functionInterfacesReleased reports whether the network interfaces Lambda created in the cluster VPC for the
+// connector function are gone. Lambda releases them some time after the function is deleted, and they block the
+// deletion of the subnets and security groups they are attached to until then. Interfaces that are already detached
+// are deleted right away.
+func functionInterfacesReleased(svc ec2iface.EC2API, model *Model) (OperationComplete, error) {
+	functionName := FunctionNamePrefix + *model.Name
+	response, err := svc.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			{
+				// interfaces created before Lambda shared them between functions carry a suffix
+				Name:   aws.String("description"),
+				Values: aws.StringSlice([]string{"AWS Lambda VPC ENI-" + functionName + "*"}),
+			},
+			{
+				// the description alone would also match the functions of clusters whose names start with this one's
+				Name:   aws.String("requester-id"),
+				Values: aws.StringSlice([]string{"*:" + functionName}),
+			},
+		},
+	})
+	if err != nil {
+		return Complete, err
+	}
+	for _, eni := range response.NetworkInterfaces {
+		if aws.StringValue(eni.Status) != ec2.NetworkInterfaceStatusAvailable {
+			continue
+		}
+		log.Printf("Deleting network interface %v...\n", *eni.NetworkInterfaceId)
+		_, err := svc.DeleteNetworkInterface(&ec2.DeleteNetworkInterfaceInput{NetworkInterfaceId: eni.NetworkInterfaceId})
+		if err != nil && !matchesAwsErrorCode(err, "InvalidNetworkInterfaceID.NotFound") {
+			return Complete, err
+		}
+	}
+	if len(response.NetworkInterfaces) > 0 {
+		log.Printf("Waiting for %v network interfaces to be released...\n", len(response.NetworkInterfaces))
+		return InProgress, nil
+	}
+	return Complete, nil
+}
+
 func stabilizeFunction(svc lambdaiface.LambdaAPI, model *Model, functionName *string) (OperationComplete, error) {
 	for {
 		output, err := svc.GetFunction(&lambda.GetFunctionInput{FunctionName: functionName})
@@ -207,17 +378,21 @@ func stabilizeFunction(svc lambdaiface.LambdaAPI, model *Model, functionName *st
 	}
 }
 
-func invokeLambda(session *session.Session, svc lambdaiface.LambdaAPI, clusterName *string, iamAuthMap *IamAuthMap, action Action) (*IamAuthMap, error) {
+// invokeLambda runs event on the VPC connector function of the cluster, adding the cluster endpoint and credentials.
+func invokeLambda(session *session.Session, svc lambdaiface.LambdaAPI, clusterName *string, event Event) (*IamAuthMap, error) {
 	endpoint, caData, err := GetClusterDetails(eks.New(session), clusterName)
 	if err != nil {
 		return nil, err
 	}
-	event := Event{
-		ClusterName: clusterName,
-		Endpoint:    endpoint,
-		CaData:      caData,
-		AwsAuth:     iamAuthMap,
-		Action:      action,
+	event.ClusterName = clusterName
+	event.Endpoint = endpoint
+	event.CaData = caData
+	// only the bootstrap needs the caller's access, later calls authenticate as the function's own role
+	if event.Action == CreateAction {
+		event.Token, err = GetToken(session, clusterName)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	eventJson, err := json.Marshal(event)
@@ -0,0 +1,301 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func testConnectorConfig() connectorConfig {
+	return connectorConfig{
+		RoleArn:          aws.String("arn:aws:iam::123456789012:role/connector"),
+		MemorySize:       MemorySize,
+		Timeout:          Timeout,
+		Architecture:     lambda.ArchitectureX8664,
+		SecurityGroupIds: []string{"sg-1", "sg-2"},
+		SubnetIds:        []string{"subnet-1", "subnet-2"},
+	}
+}
+
+func testFunctionConfiguration() *lambda.FunctionConfiguration {
+	return &lambda.FunctionConfiguration{
+		FunctionArn:   aws.String("arn:aws:lambda:us-east-1:123456789012:function:" + FunctionNamePrefix + "cluster"),
+		Role:          aws.String("arn:aws:iam::123456789012:role/connector"),
+		Handler:       aws.String(Handler),
+		Runtime:       aws.String(Runtime),
+		MemorySize:    aws.Int64(MemorySize),
+		Timeout:       aws.Int64(Timeout),
+		Architectures: aws.StringSlice([]string{lambda.ArchitectureX8664}),
+		VpcConfig: &lambda.VpcConfigResponse{
+			SecurityGroupIds: aws.StringSlice([]string{"sg-2", "sg-1"}),
+			SubnetIds:        aws.StringSlice([]string{"subnet-1", "subnet-2"}),
+		},
+	}
+}
+
+func TestMakeConnectorConfig(t *testing.T) {
+	roleArn := aws.String("arn:aws:iam::123456789012:role/connector")
+	tests := map[string]struct {
+		connector *VpcConnector
+		expected  connectorConfig
+	}{
+		"defaults": {
+			expected: connectorConfig{
+				RoleArn:          roleArn,
+				MemorySize:       MemorySize,
+				Timeout:          Timeout,
+				Architecture:     lambda.ArchitectureX8664,
+				SecurityGroupIds: []string{"sg-1"},
+				SubnetIds:        []string{"subnet-1", "subnet-2"},
+			},
+		},
+		"overrides": {
+			connector: &VpcConnector{
+				MemorySize:       aws.Int(512),
+				Timeout:          aws.Int(300),
+				Architecture:     aws.String(lambda.ArchitectureArm64),
+				SecurityGroupIds: []string{"sg-1", "sg-2"},
+				SubnetIds:        []string{"subnet-3"},
+				Environment:      map[string]string{"HTTPS_PROXY": "http://proxy:3128"},
+			},
+			expected: connectorConfig{
+				RoleArn:          roleArn,
+				MemorySize:       512,
+				Timeout:          300,
+				Architecture:     lambda.ArchitectureArm64,
+				SecurityGroupIds: []string{"sg-1", "sg-2"},
+				SubnetIds:        []string{"subnet-3"},
+				Environment:      map[string]string{"HTTPS_PROXY": "http://proxy:3128"},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			model := testModel("1.23")
+			model.ResourcesVpcConfig.SecurityGroupIds = []string{"sg-1"}
+			model.VpcConnector = tc.connector
+			config := makeConnectorConfig(model, roleArn)
+			if !reflect.DeepEqual(config, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, config)
+			}
+			if !reflect.DeepEqual(model.ResourcesVpcConfig.SecurityGroupIds, []string{"sg-1"}) {
+				t.Errorf("expected the cluster security groups to be left alone, got %v", model.ResourcesVpcConfig.SecurityGroupIds)
+			}
+		})
+	}
+}
+
+func TestFunctionConfigChanged(t *testing.T) {
+	tests := map[string]struct {
+		change   func(*connectorConfig)
+		expected bool
+	}{
+		"unchanged": {
+			change: func(*connectorConfig) {},
+		},
+		"empty environment": {
+			change: func(c *connectorConfig) { c.Environment = map[string]string{} },
+		},
+		"role": {
+			change:   func(c *connectorConfig) { c.RoleArn = aws.String("arn:aws:iam::123456789012:role/other") },
+			expected: true,
+		},
+		"memory size": {
+			change:   func(c *connectorConfig) { c.MemorySize = 512 },
+			expected: true,
+		},
+		"timeout": {
+			change:   func(c *connectorConfig) { c.Timeout = 300 },
+			expected: true,
+		},
+		"security groups": {
+			change:   func(c *connectorConfig) { c.SecurityGroupIds = []string{"sg-1"} },
+			expected: true,
+		},
+		"subnets": {
+			change:   func(c *connectorConfig) { c.SubnetIds = []string{"subnet-1", "subnet-3"} },
+			expected: true,
+		},
+		"environment": {
+			change:   func(c *connectorConfig) { c.Environment = map[string]string{"HTTPS_PROXY": "http://proxy:3128"} },
+			expected: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := testConnectorConfig()
+			tc.change(&config)
+			if changed := functionConfigChanged(testFunctionConfiguration(), config); changed != tc.expected {
+				t.Errorf("expected changed to be %v, got %v", tc.expected, changed)
+			}
+		})
+	}
+}
+
+type mockLambdaClient struct {
+	lambdaiface.LambdaAPI
+	configuration *lambda.FunctionConfiguration
+	calls         []string
+}
+
+func (m *mockLambdaClient) GetFunction(*lambda.GetFunctionInput) (*lambda.GetFunctionOutput, error) {
+	return &lambda.GetFunctionOutput{Configuration: m.configuration}, nil
+}
+
+func (m *mockLambdaClient) UpdateFunctionCode(*lambda.UpdateFunctionCodeInput) (*lambda.FunctionConfiguration, error) {
+	m.calls = append(m.calls, "UpdateFunctionCode")
+	return m.configuration, nil
+}
+
+func (m *mockLambdaClient) WaitUntilFunctionUpdatedV2(*lambda.GetFunctionInput) error {
+	m.calls = append(m.calls, "WaitUntilFunctionUpdatedV2")
+	return nil
+}
+
+func (m *mockLambdaClient) UpdateFunctionConfiguration(*lambda.UpdateFunctionConfigurationInput) (*lambda.FunctionConfiguration, error) {
+	m.calls = append(m.calls, "UpdateFunctionConfiguration")
+	return m.configuration, nil
+}
+
+func (m *mockLambdaClient) ListTags(*lambda.ListTagsInput) (*lambda.ListTagsOutput, error) {
+	return &lambda.ListTagsOutput{}, nil
+}
+
+// withZipFile runs the test in a directory holding a connector function package, and returns the package's hash.
+func withZipFile(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "connector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	})
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	zip := []byte("connector")
+	if err := ioutil.WriteFile(ZipFile, zip, 0600); err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(zip)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func TestUpdateFunction(t *testing.T) {
+	hash := withZipFile(t)
+	tests := map[string]struct {
+		codeSha256 string
+		config     func(*connectorConfig)
+		calls      []string
+	}{
+		"unchanged": {
+			codeSha256: hash,
+			config:     func(*connectorConfig) {},
+		},
+		"code": {
+			config: func(*connectorConfig) {},
+			calls:  []string{"UpdateFunctionCode"},
+		},
+		"configuration": {
+			codeSha256: hash,
+			config:     func(c *connectorConfig) { c.Timeout = 300 },
+			calls:      []string{"WaitUntilFunctionUpdatedV2", "UpdateFunctionConfiguration"},
+		},
+		"code and configuration": {
+			config: func(c *connectorConfig) { c.Timeout = 300 },
+			calls:  []string{"UpdateFunctionCode", "WaitUntilFunctionUpdatedV2", "UpdateFunctionConfiguration"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			configuration := testFunctionConfiguration()
+			configuration.CodeSha256 = aws.String(tc.codeSha256)
+			svc := &mockLambdaClient{configuration: configuration}
+			config := testConnectorConfig()
+			tc.config(&config)
+			if err := updateFunction(svc, aws.String("cluster"), config, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(svc.calls, tc.calls) {
+				t.Errorf("expected calls %v, got %v", tc.calls, svc.calls)
+			}
+		})
+	}
+}
+
+type mockEC2Client struct {
+	ec2iface.EC2API
+	interfaces []*ec2.NetworkInterface
+	filters    []*ec2.Filter
+	deleted    []string
+}
+
+func (m *mockEC2Client) DescribeNetworkInterfaces(input *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	m.filters = input.Filters
+	return &ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: m.interfaces}, nil
+}
+
+func (m *mockEC2Client) DeleteNetworkInterface(input *ec2.DeleteNetworkInterfaceInput) (*ec2.DeleteNetworkInterfaceOutput, error) {
+	m.deleted = append(m.deleted, *input.NetworkInterfaceId)
+	return &ec2.DeleteNetworkInterfaceOutput{}, nil
+}
+
+func TestFunctionInterfacesReleased(t *testing.T) {
+	tests := map[string]struct {
+		interfaces []*ec2.NetworkInterface
+		complete   OperationComplete
+		deleted    []string
+	}{
+		"released": {
+			complete: Complete,
+		},
+		"in use": {
+			interfaces: []*ec2.NetworkInterface{{NetworkInterfaceId: aws.String("eni-1"), Status: aws.String(ec2.NetworkInterfaceStatusInUse)}},
+			complete:   InProgress,
+		},
+		"detached": {
+			interfaces: []*ec2.NetworkInterface{
+				{NetworkInterfaceId: aws.String("eni-1"), Status: aws.String(ec2.NetworkInterfaceStatusAvailable)},
+				{NetworkInterfaceId: aws.String("eni-2"), Status: aws.String(ec2.NetworkInterfaceStatusInUse)},
+			},
+			complete: InProgress,
+			deleted:  []string{"eni-1"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockEC2Client{interfaces: tc.interfaces}
+			complete, err := functionInterfacesReleased(svc, testModel("1.23"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if complete != tc.complete || !reflect.DeepEqual(svc.deleted, tc.deleted) {
+				t.Errorf("expected complete %v after deleting %v, got %v after deleting %v", tc.complete, tc.deleted, complete, svc.deleted)
+			}
+			filters := map[string][]string{}
+			for _, f := range svc.filters {
+				filters[*f.Name] = aws.StringValueSlice(f.Values)
+			}
+			expected := map[string][]string{
+				"description":  {"AWS Lambda VPC ENI-" + FunctionNamePrefix + "cluster*"},
+				"requester-id": {"*:" + FunctionNamePrefix + "cluster"},
+			}
+			if !reflect.DeepEqual(filters, expected) {
+				t.Errorf("expected filters %v, got %v", expected, filters)
+			}
+		})
+	}
+}
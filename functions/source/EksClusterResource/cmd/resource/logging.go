@@ -0,0 +1,124 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"log"
+)
+
+func managesLogGroup(model *Model) bool {
+	return model.ControlPlaneLogging != nil
+}
+
+func deletesLogGroup(model *Model) bool {
+	return managesLogGroup(model) && model.ControlPlaneLogging.DeleteOnClusterDelete != nil &&
+		*model.ControlPlaneLogging.DeleteOnClusterDelete
+}
+
+// logGroupName returns the name of the log group EKS sends control plane logs to.
+func logGroupName(model *Model) *string {
+	return aws.String(fmt.Sprintf("/aws/eks/%s/cluster", *model.Name))
+}
+
+// putLogGroup creates the control plane log group, or brings the retention, KMS key and tags of the existing one in
+// line with the model. It runs before logging is enabled, as EKS would otherwise create the group with its defaults.
+func putLogGroup(svc cloudwatchlogsiface.CloudWatchLogsAPI, model *Model) error {
+	name := logGroupName(model)
+	config := model.ControlPlaneLogging
+	current, err := describeLogGroup(svc, name)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		log.Printf("Creating log group %v...\n", *name)
+		input := &cloudwatchlogs.CreateLogGroupInput{
+			LogGroupName: name,
+			KmsKeyId:     config.KmsKeyId,
+		}
+		if len(config.Tags) > 0 {
+			input.Tags = aws.StringMap(tagsToMap(config.Tags))
+		}
+		_, err = svc.CreateLogGroup(input)
+		if err != nil && !matchesAwsErrorCode(err, cloudwatchlogs.ErrCodeResourceAlreadyExistsException) {
+			return err
+		}
+		if config.RetentionInDays != nil {
+			_, err = svc.PutRetentionPolicy(&cloudwatchlogs.PutRetentionPolicyInput{
+				LogGroupName:    name,
+				RetentionInDays: aws.Int64(int64(*config.RetentionInDays)),
+			})
+		}
+		return err
+	}
+	if aws.Int64Value(current.RetentionInDays) != int64(aws.IntValue(config.RetentionInDays)) {
+		log.Printf("Updating retention of log group %v...\n", *name)
+		if config.RetentionInDays == nil {
+			_, err = svc.DeleteRetentionPolicy(&cloudwatchlogs.DeleteRetentionPolicyInput{LogGroupName: name})
+		} else {
+			_, err = svc.PutRetentionPolicy(&cloudwatchlogs.PutRetentionPolicyInput{
+				LogGroupName:    name,
+				RetentionInDays: aws.Int64(int64(*config.RetentionInDays)),
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if aws.StringValue(current.KmsKeyId) != aws.StringValue(config.KmsKeyId) {
+		log.Printf("Updating KMS key of log group %v...\n", *name)
+		if config.KmsKeyId == nil {
+			_, err = svc.DisassociateKmsKey(&cloudwatchlogs.DisassociateKmsKeyInput{LogGroupName: name})
+		} else {
+			_, err = svc.AssociateKmsKey(&cloudwatchlogs.AssociateKmsKeyInput{LogGroupName: name, KmsKeyId: config.KmsKeyId})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return updateLogGroupTags(svc, current.LogGroupArn, config.Tags)
+}
+
+func updateLogGroupTags(svc cloudwatchlogsiface.CloudWatchLogsAPI, arn *string, tags []Tags) error {
+	response, err := svc.ListTagsForResource(&cloudwatchlogs.ListTagsForResourceInput{ResourceArn: arn})
+	if err != nil {
+		return err
+	}
+	added, removed := diffTags(aws.StringValueMap(response.Tags), tagsToMap(tags))
+	if len(removed) > 0 {
+		_, err = svc.UntagResource(&cloudwatchlogs.UntagResourceInput{ResourceArn: arn, TagKeys: removed})
+		if err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 {
+		_, err = svc.TagResource(&cloudwatchlogs.TagResourceInput{ResourceArn: arn, Tags: added})
+	}
+	return err
+}
+
+func describeLogGroup(svc cloudwatchlogsiface.CloudWatchLogsAPI, name *string) (*cloudwatchlogs.LogGroup, error) {
+	var group *cloudwatchlogs.LogGroup
+	input := &cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: name}
+	err := svc.DescribeLogGroupsPages(input, func(page *cloudwatchlogs.DescribeLogGroupsOutput, lastPage bool) bool {
+		for _, g := range page.LogGroups {
+			if aws.StringValue(g.LogGroupName) == *name {
+				group = g
+				return false
+			}
+		}
+		return true
+	})
+	return group, err
+}
+
+func deleteLogGroup(svc cloudwatchlogsiface.CloudWatchLogsAPI, model *Model) error {
+	name := logGroupName(model)
+	log.Printf("Deleting log group %v...\n", *name)
+	_, err := svc.DeleteLogGroup(&cloudwatchlogs.DeleteLogGroupInput{LogGroupName: name})
+	if err != nil && !matchesAwsErrorCode(err, cloudwatchlogs.ErrCodeResourceNotFoundException) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"reflect"
+	"testing"
+)
+
+func TestDeletesLogGroup(t *testing.T) {
+	tests := map[string]struct {
+		logging  *ControlPlaneLogging
+		manages  bool
+		expected bool
+	}{
+		"not managed": {},
+		"kept": {
+			logging: &ControlPlaneLogging{},
+			manages: true,
+		},
+		"deleted": {
+			logging:  &ControlPlaneLogging{DeleteOnClusterDelete: aws.Bool(true)},
+			manages:  true,
+			expected: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			model := &Model{ControlPlaneLogging: tc.logging}
+			if manages := managesLogGroup(model); manages != tc.manages {
+				t.Errorf("expected manages to be %v, got %v", tc.manages, manages)
+			}
+			if deletes := deletesLogGroup(model); deletes != tc.expected {
+				t.Errorf("expected deletes to be %v, got %v", tc.expected, deletes)
+			}
+		})
+	}
+}
+
+type mockLogsClient struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+	groups []*cloudwatchlogs.LogGroup
+	tags   map[string]string
+	calls  []string
+}
+
+func (m *mockLogsClient) DescribeLogGroupsPages(_ *cloudwatchlogs.DescribeLogGroupsInput, fn func(*cloudwatchlogs.DescribeLogGroupsOutput, bool) bool) error {
+	fn(&cloudwatchlogs.DescribeLogGroupsOutput{LogGroups: m.groups}, true)
+	return nil
+}
+
+func (m *mockLogsClient) CreateLogGroup(*cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	m.calls = append(m.calls, "CreateLogGroup")
+	return &cloudwatchlogs.CreateLogGroupOutput{}, nil
+}
+
+func (m *mockLogsClient) PutRetentionPolicy(*cloudwatchlogs.PutRetentionPolicyInput) (*cloudwatchlogs.PutRetentionPolicyOutput, error) {
+	m.calls = append(m.calls, "PutRetentionPolicy")
+	return &cloudwatchlogs.PutRetentionPolicyOutput{}, nil
+}
+
+func (m *mockLogsClient) DeleteRetentionPolicy(*cloudwatchlogs.DeleteRetentionPolicyInput) (*cloudwatchlogs.DeleteRetentionPolicyOutput, error) {
+	m.calls = append(m.calls, "DeleteRetentionPolicy")
+	return &cloudwatchlogs.DeleteRetentionPolicyOutput{}, nil
+}
+
+func (m *mockLogsClient) AssociateKmsKey(*cloudwatchlogs.AssociateKmsKeyInput) (*cloudwatchlogs.AssociateKmsKeyOutput, error) {
+	m.calls = append(m.calls, "AssociateKmsKey")
+	return &cloudwatchlogs.AssociateKmsKeyOutput{}, nil
+}
+
+func (m *mockLogsClient) DisassociateKmsKey(*cloudwatchlogs.DisassociateKmsKeyInput) (*cloudwatchlogs.DisassociateKmsKeyOutput, error) {
+	m.calls = append(m.calls, "DisassociateKmsKey")
+	return &cloudwatchlogs.DisassociateKmsKeyOutput{}, nil
+}
+
+func (m *mockLogsClient) ListTagsForResource(*cloudwatchlogs.ListTagsForResourceInput) (*cloudwatchlogs.ListTagsForResourceOutput, error) {
+	return &cloudwatchlogs.ListTagsForResourceOutput{Tags: aws.StringMap(m.tags)}, nil
+}
+
+func (m *mockLogsClient) TagResource(*cloudwatchlogs.TagResourceInput) (*cloudwatchlogs.TagResourceOutput, error) {
+	m.calls = append(m.calls, "TagResource")
+	return &cloudwatchlogs.TagResourceOutput{}, nil
+}
+
+func (m *mockLogsClient) UntagResource(*cloudwatchlogs.UntagResourceInput) (*cloudwatchlogs.UntagResourceOutput, error) {
+	m.calls = append(m.calls, "UntagResource")
+	return &cloudwatchlogs.UntagResourceOutput{}, nil
+}
+
+func (m *mockLogsClient) DeleteLogGroup(*cloudwatchlogs.DeleteLogGroupInput) (*cloudwatchlogs.DeleteLogGroupOutput, error) {
+	m.calls = append(m.calls, "DeleteLogGroup")
+	if len(m.groups) == 0 {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException, "log group not found", nil)
+	}
+	return &cloudwatchlogs.DeleteLogGroupOutput{}, nil
+}
+
+func TestPutLogGroup(t *testing.T) {
+	key := "arn:aws:kms:us-east-1:123456789012:key/1"
+	group := func(retention int64, kmsKeyId *string) []*cloudwatchlogs.LogGroup {
+		return []*cloudwatchlogs.LogGroup{
+			// groups sharing the name as a prefix are left alone
+			{LogGroupName: aws.String("/aws/eks/cluster/cluster-other"), RetentionInDays: aws.Int64(1)},
+			{
+				LogGroupName:    aws.String("/aws/eks/cluster/cluster"),
+				LogGroupArn:     aws.String("arn:aws:logs:us-east-1:123456789012:log-group:/aws/eks/cluster/cluster"),
+				RetentionInDays: aws.Int64(retention),
+				KmsKeyId:        kmsKeyId,
+			},
+		}
+	}
+	tests := map[string]struct {
+		groups  []*cloudwatchlogs.LogGroup
+		tags    map[string]string
+		logging ControlPlaneLogging
+		calls   []string
+	}{
+		"created": {
+			logging: ControlPlaneLogging{RetentionInDays: aws.Int(30)},
+			calls:   []string{"CreateLogGroup", "PutRetentionPolicy"},
+		},
+		"created with defaults": {
+			calls: []string{"CreateLogGroup"},
+		},
+		"unchanged": {
+			groups:  group(30, aws.String(key)),
+			tags:    map[string]string{"team": "platform"},
+			logging: ControlPlaneLogging{RetentionInDays: aws.Int(30), KmsKeyId: aws.String(key), Tags: []Tags{{Key: aws.String("team"), Value: aws.String("platform")}}},
+		},
+		"retention changed": {
+			groups:  group(30, nil),
+			logging: ControlPlaneLogging{RetentionInDays: aws.Int(90)},
+			calls:   []string{"PutRetentionPolicy"},
+		},
+		"retention removed": {
+			groups: group(30, nil),
+			calls:  []string{"DeleteRetentionPolicy"},
+		},
+		"key added": {
+			groups:  group(0, nil),
+			logging: ControlPlaneLogging{KmsKeyId: aws.String(key)},
+			calls:   []string{"AssociateKmsKey"},
+		},
+		"key removed": {
+			groups: group(0, aws.String(key)),
+			calls:  []string{"DisassociateKmsKey"},
+		},
+		"tags changed": {
+			groups:  group(0, nil),
+			tags:    map[string]string{"env": "prod"},
+			logging: ControlPlaneLogging{Tags: []Tags{{Key: aws.String("team"), Value: aws.String("platform")}}},
+			calls:   []string{"UntagResource", "TagResource"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockLogsClient{groups: tc.groups, tags: tc.tags}
+			logging := tc.logging
+			if err := putLogGroup(svc, &Model{Name: aws.String("cluster"), ControlPlaneLogging: &logging}); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(svc.calls, tc.calls) {
+				t.Errorf("expected calls %v, got %v", tc.calls, svc.calls)
+			}
+		})
+	}
+}
+
+func TestDeleteLogGroup(t *testing.T) {
+	tests := map[string]struct {
+		groups []*cloudwatchlogs.LogGroup
+	}{
+		"deleted": {
+			groups: []*cloudwatchlogs.LogGroup{{LogGroupName: aws.String("/aws/eks/cluster/cluster")}},
+		},
+		"already gone": {},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockLogsClient{groups: tc.groups}
+			if err := deleteLogGroup(svc, &Model{Name: aws.String("cluster")}); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(svc.calls, []string{"DeleteLogGroup"}) {
+				t.Errorf("expected the log group to be deleted, got calls %v", svc.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"log"
+	"reflect"
+	"regexp"
+	"sigs.k8s.io/yaml"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	manifestFieldManager = "awsqs-eks-cluster"
+	// synchronous Lambda invocations accept at most 6 MB, part of which the rest of the event takes up
+	maxConnectorManifestsSize    = 6*1024*1024 - 64*1024
+	customResourceDefinitionKind = "CustomResourceDefinition"
+	// custom resource definitions usually become established within seconds
+	resourceDiscoveryAttempts = 30
+	resourceDiscoveryInterval = 2 * time.Second
+)
+
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// manifestObject is a single Kubernetes object from a bootstrap manifest, along with its apply configuration.
+type manifestObject struct {
+	ApiVersion string
+	Kind       string
+	Name       string
+	Namespace  string
+	Body       []byte
+}
+
+// changedBootstrapManifests returns the manifests that were added or changed since the previous invocation, along with
+// every manifest read from S3, as the object behind an unchanged URL may have changed. Objects of manifests that were
+// removed are left in the cluster.
+func changedBootstrapManifests(desired *Model, previous *Model) []BootstrapManifest {
+	var changed []BootstrapManifest
+	for _, manifest := range desired.BootstrapManifests {
+		found := false
+		if previous != nil && manifest.S3Url == nil {
+			for _, p := range previous.BootstrapManifests {
+				if reflect.DeepEqual(manifest, p) {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			changed = append(changed, manifest)
+		}
+	}
+	return changed
+}
+
+// applyBootstrapManifests applies manifests to the cluster with server-side apply, through the VPC connector function
+// when the API server isn't reachable from the handler.
+func applyBootstrapManifests(sess *session.Session, svc eksiface.EKSAPI, model *Model, manifests []BootstrapManifest, private bool) error {
+	contents, err := readBootstrapManifests(s3.New(sess), manifests)
+	if err != nil {
+		return err
+	}
+	if private {
+		if err := checkConnectorManifestsSize(contents); err != nil {
+			return err
+		}
+		_, err = invokeLambda(sess, lambda.New(sess), model.Name, Event{Action: ApplyAction, Manifests: contents})
+		return err
+	}
+	clientset, err := CreateKubeClientEks(sess, svc, model.Name)
+	if err != nil {
+		return err
+	}
+	return ApplyManifests(clientset, contents)
+}
+
+// readBootstrapManifests returns the YAML of each manifest, downloading the ones given as S3 URLs.
+func readBootstrapManifests(svc s3iface.S3API, manifests []BootstrapManifest) ([]string, error) {
+	var contents []string
+	for _, manifest := range manifests {
+		if manifest.Content != nil {
+			contents = append(contents, *manifest.Content)
+			continue
+		}
+		bucket, key, err := parseS3Url(*manifest.S3Url)
+		if err != nil {
+			return nil, err
+		}
+		response, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, string(content))
+	}
+	return contents, nil
+}
+
+// checkConnectorManifestsSize fails when the manifests don't fit in the payload of a VPC connector function invocation.
+func checkConnectorManifestsSize(contents []string) error {
+	// the manifests are sent JSON encoded, which escapes quotes and newlines
+	encoded, err := json.Marshal(contents)
+	if err != nil {
+		return err
+	}
+	if len(encoded) > maxConnectorManifestsSize {
+		return invalidRequestError(fmt.Sprintf("BootstrapManifests are %v bytes once encoded, over the %v bytes that can be sent to the VPC connector function",
+			len(encoded), maxConnectorManifestsSize))
+	}
+	return nil
+}
+
+func parseS3Url(url string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(url, "s3://"), "/", 2)
+	if !strings.HasPrefix(url, "s3://") || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", invalidRequestError(fmt.Sprintf("%v is not an S3 URL of the form s3://bucket/key", url))
+	}
+	return parts[0], parts[1], nil
+}
+
+// ApplyManifests server-side applies the objects of the given YAML manifests. Namespaces and then custom resource
+// definitions are applied first so that the objects placed in them, or of their kinds, can be created in the same
+// call.
+func ApplyManifests(clientset *kubernetes.Clientset, manifests []string) error {
+	var objects []manifestObject
+	for _, manifest := range manifests {
+		parsed, err := parseManifest(manifest)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, parsed...)
+	}
+	sortManifestObjects(objects)
+	resources := make(map[string]map[string]resourceInfo)
+	definitionsApplied := false
+	for _, object := range objects {
+		resource, err := findResource(clientset, resources, object, definitionsApplied)
+		if err != nil {
+			return err
+		}
+		log.Printf("Applying %v %v...\n", object.Kind, object.Name)
+		err = clientset.Discovery().RESTClient().
+			Patch(types.ApplyPatchType).
+			AbsPath(resourcePath(object, resource)).
+			Param("fieldManager", manifestFieldManager).
+			Param("force", "true").
+			Body(object.Body).
+			Do(context.Background()).
+			Error()
+		if err != nil {
+			return fmt.Errorf("applying %v %v: %v", object.Kind, object.Name, err)
+		}
+		if object.Kind == customResourceDefinitionKind {
+			definitionsApplied = true
+		}
+	}
+	return nil
+}
+
+// sortManifestObjects orders Namespaces first and CustomResourceDefinitions second, keeping the order of the manifests
+// otherwise.
+func sortManifestObjects(objects []manifestObject) {
+	rank := func(kind string) int {
+		switch kind {
+		case "Namespace":
+			return 0
+		case customResourceDefinitionKind:
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		return rank(objects[i].Kind) < rank(objects[j].Kind)
+	})
+}
+
+// findResource returns the resource serving the kind of the object. Once custom resource definitions have been
+// applied, kinds the API server doesn't serve yet are waited for until the definitions are established.
+func findResource(clientset *kubernetes.Clientset, resources map[string]map[string]resourceInfo, object manifestObject, definitionsApplied bool) (resourceInfo, error) {
+	for attempt := 0; ; attempt++ {
+		if resources[object.ApiVersion] == nil {
+			found, err := discoverResources(clientset, object.ApiVersion)
+			if err != nil && (!definitionsApplied || attempt >= resourceDiscoveryAttempts) {
+				return resourceInfo{}, err
+			}
+			resources[object.ApiVersion] = found
+		}
+		if resource, ok := resources[object.ApiVersion][object.Kind]; ok {
+			return resource, nil
+		}
+		if !definitionsApplied || attempt >= resourceDiscoveryAttempts {
+			return resourceInfo{}, fmt.Errorf("%v %v is not served by the cluster", object.ApiVersion, object.Kind)
+		}
+		log.Printf("Waiting for %v %v to be served...\n", object.ApiVersion, object.Kind)
+		delete(resources, object.ApiVersion)
+		time.Sleep(resourceDiscoveryInterval)
+	}
+}
+
+// parseManifest splits a multi-document YAML manifest into its objects.
+func parseManifest(manifest string) ([]manifestObject, error) {
+	var objects []manifestObject
+	for _, document := range documentSeparator.Split(manifest, -1) {
+		if strings.TrimSpace(document) == "" {
+			continue
+		}
+		body, err := yaml.YAMLToJSON([]byte(document))
+		if err != nil {
+			return nil, invalidRequestError(fmt.Sprintf("invalid manifest: %v", err))
+		}
+		// documents that only hold comments
+		if string(body) == "null" {
+			continue
+		}
+		var header struct {
+			ApiVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+		}
+		if err := yaml.Unmarshal(body, &header); err != nil {
+			return nil, invalidRequestError(fmt.Sprintf("invalid manifest: %v", err))
+		}
+		if header.ApiVersion == "" || header.Kind == "" || header.Metadata.Name == "" {
+			return nil, invalidRequestError("manifest objects require apiVersion, kind and metadata.name")
+		}
+		objects = append(objects, manifestObject{
+			ApiVersion: header.ApiVersion,
+			Kind:       header.Kind,
+			Name:       header.Metadata.Name,
+			Namespace:  header.Metadata.Namespace,
+			Body:       body,
+		})
+	}
+	return objects, nil
+}
+
+type resourceInfo struct {
+	Name       string
+	Namespaced bool
+}
+
+// discoverResources returns the resources the API server serves for apiVersion, by kind.
+func discoverResources(clientset *kubernetes.Clientset, apiVersion string) (map[string]resourceInfo, error) {
+	list, err := clientset.Discovery().ServerResourcesForGroupVersion(apiVersion)
+	if err != nil {
+		return nil, err
+	}
+	resources := make(map[string]resourceInfo)
+	for _, r := range list.APIResources {
+		// skip subresources such as deployments/scale
+		if strings.Contains(r.Name, "/") {
+			continue
+		}
+		resources[r.Kind] = resourceInfo{Name: r.Name, Namespaced: r.Namespaced}
+	}
+	if len(resources) == 0 {
+		return nil, errors.New("no resources found for " + apiVersion)
+	}
+	return resources, nil
+}
+
+func resourcePath(object manifestObject, resource resourceInfo) string {
+	path := "/apis/" + object.ApiVersion
+	if !strings.Contains(object.ApiVersion, "/") {
+		path = "/api/" + object.ApiVersion
+	}
+	if resource.Namespaced {
+		namespace := object.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		path += "/namespaces/" + namespace
+	}
+	return path + "/" + resource.Name + "/" + object.Name
+}
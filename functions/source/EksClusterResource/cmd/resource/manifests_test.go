@@ -0,0 +1,184 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	tests := map[string]struct {
+		manifest string
+		expected []manifestObject
+		invalid  bool
+	}{
+		"several documents": {
+			manifest: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: apps\n---\n# comment only\n---\n" +
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  namespace: apps\n",
+			expected: []manifestObject{
+				{ApiVersion: "v1", Kind: "Namespace", Name: "apps"},
+				{ApiVersion: "v1", Kind: "ConfigMap", Name: "settings", Namespace: "apps"},
+			},
+		},
+		"empty": {
+			manifest: "---\n",
+		},
+		"malformed": {
+			manifest: "apiVersion: v1\nkind: [Namespace\n",
+			invalid:  true,
+		},
+		"missing name": {
+			manifest: "apiVersion: v1\nkind: Namespace\n",
+			invalid:  true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			objects, err := parseManifest(tc.manifest)
+			if tc.invalid {
+				if !matchesAwsErrorCode(err, eks.ErrCodeInvalidParameterException) {
+					t.Errorf("expected an invalid request error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range objects {
+				objects[i].Body = nil
+			}
+			if !reflect.DeepEqual(objects, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, objects)
+			}
+		})
+	}
+}
+
+func TestSortManifestObjects(t *testing.T) {
+	objects := []manifestObject{
+		{Kind: "Widget", Name: "a"},
+		{Kind: "CustomResourceDefinition", Name: "widgets"},
+		{Kind: "ConfigMap", Name: "b"},
+		{Kind: "Namespace", Name: "apps"},
+		{Kind: "Widget", Name: "c"},
+	}
+	sortManifestObjects(objects)
+	var names []string
+	for _, object := range objects {
+		names = append(names, object.Name)
+	}
+	expected := []string{"apps", "widgets", "a", "b", "c"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestParseS3Url(t *testing.T) {
+	tests := map[string]struct {
+		url     string
+		bucket  string
+		key     string
+		invalid bool
+	}{
+		"nested key": {
+			url:    "s3://bucket/manifests/namespaces.yaml",
+			bucket: "bucket",
+			key:    "manifests/namespaces.yaml",
+		},
+		"https url": {
+			url:     "https://bucket.s3.amazonaws.com/namespaces.yaml",
+			invalid: true,
+		},
+		"missing key": {
+			url:     "s3://bucket/",
+			invalid: true,
+		},
+		"missing bucket": {
+			url:     "s3:///namespaces.yaml",
+			invalid: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			bucket, key, err := parseS3Url(tc.url)
+			if tc.invalid {
+				if !matchesAwsErrorCode(err, eks.ErrCodeInvalidParameterException) {
+					t.Errorf("expected an invalid request error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bucket != tc.bucket || key != tc.key {
+				t.Errorf("expected %v and %v, got %v and %v", tc.bucket, tc.key, bucket, key)
+			}
+		})
+	}
+}
+
+func TestCheckConnectorManifestsSize(t *testing.T) {
+	tests := map[string]struct {
+		contents []string
+		invalid  bool
+	}{
+		"small": {
+			contents: []string{"apiVersion: v1\nkind: Namespace\nmetadata:\n  name: apps\n"},
+		},
+		"too large": {
+			contents: []string{strings.Repeat("a", maxConnectorManifestsSize)},
+			invalid:  true,
+		},
+		"too large once encoded": {
+			contents: []string{strings.Repeat("\n", maxConnectorManifestsSize/2+1)},
+			invalid:  true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := checkConnectorManifestsSize(tc.contents)
+			if tc.invalid != matchesAwsErrorCode(err, eks.ErrCodeInvalidParameterException) || (!tc.invalid && err != nil) {
+				t.Errorf("expected invalid to be %v, got %v", tc.invalid, err)
+			}
+		})
+	}
+}
+
+func TestChangedBootstrapManifests(t *testing.T) {
+	namespace := BootstrapManifest{Content: aws.String("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: apps\n")}
+	s3 := BootstrapManifest{S3Url: aws.String("s3://bucket/manifests.yaml")}
+	tests := map[string]struct {
+		desired  []BootstrapManifest
+		previous *Model
+		expected []BootstrapManifest
+	}{
+		"create": {
+			desired:  []BootstrapManifest{namespace, s3},
+			expected: []BootstrapManifest{namespace, s3},
+		},
+		"unchanged inline manifest": {
+			desired:  []BootstrapManifest{namespace},
+			previous: &Model{BootstrapManifests: []BootstrapManifest{namespace}},
+		},
+		"changed inline manifest": {
+			desired:  []BootstrapManifest{{Content: aws.String("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: jobs\n")}},
+			previous: &Model{BootstrapManifests: []BootstrapManifest{namespace}},
+			expected: []BootstrapManifest{{Content: aws.String("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: jobs\n")}},
+		},
+		"unchanged S3 manifest": {
+			desired:  []BootstrapManifest{namespace, s3},
+			previous: &Model{BootstrapManifests: []BootstrapManifest{namespace, s3}},
+			expected: []BootstrapManifest{s3},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			changed := changedBootstrapManifests(&Model{BootstrapManifests: tc.desired}, tc.previous)
+			if !reflect.DeepEqual(changed, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, changed)
+			}
+		})
+	}
+}
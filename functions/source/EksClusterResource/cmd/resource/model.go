@@ -7,24 +7,42 @@ type Model struct {
 	Name                       *string                  `json:",omitempty"`
 	RoleArn                    *string                  `json:",omitempty"`
 	LambdaRoleName             *string                  `json:",omitempty"`
+	VpcConnector               *VpcConnector            `json:",omitempty"`
 	Version                    *string                  `json:",omitempty"`
+	UpgradePolicy              *UpgradePolicy           `json:",omitempty"`
 	KubernetesNetworkConfig    *KubernetesNetworkConfig `json:",omitempty"`
 	ResourcesVpcConfig         *ResourcesVpcConfig      `json:",omitempty"`
 	EnabledClusterLoggingTypes []string                 `json:",omitempty"`
+	ControlPlaneLogging        *ControlPlaneLogging     `json:",omitempty"`
 	EncryptionConfig           []EncryptionConfigEntry  `json:",omitempty"`
 	KubernetesApiAccess        *KubernetesApiAccess     `json:",omitempty"`
+	AuthenticationMode         *string                  `json:",omitempty"`
+	AccessEntries              []AccessEntry            `json:",omitempty"`
+	IdentityProviderConfigs    []IdentityProviderConfig `json:",omitempty"`
+	FargateProfiles            []FargateProfile         `json:",omitempty"`
+	NodeGroups                 []NodeGroup              `json:",omitempty"`
+	Addons                     []Addon                  `json:",omitempty"`
+	BootstrapManifests         []BootstrapManifest      `json:",omitempty"`
+	CreateOIDCProvider         *bool                    `json:",omitempty"`
+	AdoptExisting              *bool                    `json:",omitempty"`
+	PrivateBootstrap           *bool                    `json:",omitempty"`
+	KubeConfig                 *KubeConfig              `json:",omitempty"`
 	Arn                        *string                  `json:",omitempty"`
 	CertificateAuthorityData   *string                  `json:",omitempty"`
 	ClusterSecurityGroupId     *string                  `json:",omitempty"`
 	Endpoint                   *string                  `json:",omitempty"`
 	EncryptionConfigKeyArn     *string                  `json:",omitempty"`
 	OIDCIssuerURL              *string                  `json:",omitempty"`
+	OIDCProviderArn            *string                  `json:",omitempty"`
+	KubeConfigSecretArn        *string                  `json:",omitempty"`
 	Tags                       []Tags                   `json:",omitempty"`
 }
 
 // KubernetesNetworkConfig is autogenerated from the json schema
 type KubernetesNetworkConfig struct {
 	ServiceIpv4Cidr *string `json:",omitempty"`
+	IpFamily        *string `json:",omitempty"`
+	ServiceIpv6Cidr *string `json:",omitempty"`
 }
 
 // ResourcesVpcConfig is autogenerated from the json schema
@@ -49,8 +67,9 @@ type Provider struct {
 
 // KubernetesApiAccess is autogenerated from the json schema
 type KubernetesApiAccess struct {
-	Roles []KubernetesApiAccessEntry `json:",omitempty"`
-	Users []KubernetesApiAccessEntry `json:",omitempty"`
+	Roles    []KubernetesApiAccessEntry `json:",omitempty"`
+	Users    []KubernetesApiAccessEntry `json:",omitempty"`
+	Accounts []string                   `json:",omitempty"`
 }
 
 // KubernetesApiAccessEntry is autogenerated from the json schema
@@ -60,6 +79,130 @@ type KubernetesApiAccessEntry struct {
 	Groups   []string `json:",omitempty"`
 }
 
+// AccessEntry is autogenerated from the json schema
+type AccessEntry struct {
+	PrincipalArn     *string        `json:",omitempty"`
+	Username         *string        `json:",omitempty"`
+	KubernetesGroups []string       `json:",omitempty"`
+	Type             *string        `json:",omitempty"`
+	AccessPolicies   []AccessPolicy `json:",omitempty"`
+}
+
+// AccessPolicy is autogenerated from the json schema
+type AccessPolicy struct {
+	PolicyArn   *string      `json:",omitempty"`
+	AccessScope *AccessScope `json:",omitempty"`
+}
+
+// AccessScope is autogenerated from the json schema
+type AccessScope struct {
+	Type       *string  `json:",omitempty"`
+	Namespaces []string `json:",omitempty"`
+}
+
+// IdentityProviderConfig is autogenerated from the json schema
+type IdentityProviderConfig struct {
+	Name           *string           `json:",omitempty"`
+	IssuerUrl      *string           `json:",omitempty"`
+	ClientId       *string           `json:",omitempty"`
+	UsernameClaim  *string           `json:",omitempty"`
+	UsernamePrefix *string           `json:",omitempty"`
+	GroupsClaim    *string           `json:",omitempty"`
+	GroupsPrefix   *string           `json:",omitempty"`
+	RequiredClaims map[string]string `json:",omitempty"`
+}
+
+// FargateProfile is autogenerated from the json schema
+type FargateProfile struct {
+	Name                *string                  `json:",omitempty"`
+	PodExecutionRoleArn *string                  `json:",omitempty"`
+	Subnets             []string                 `json:",omitempty"`
+	Selectors           []FargateProfileSelector `json:",omitempty"`
+}
+
+// FargateProfileSelector is autogenerated from the json schema
+type FargateProfileSelector struct {
+	Namespace *string           `json:",omitempty"`
+	Labels    map[string]string `json:",omitempty"`
+}
+
+// NodeGroup is autogenerated from the json schema
+type NodeGroup struct {
+	Name           *string                 `json:",omitempty"`
+	NodeRole       *string                 `json:",omitempty"`
+	Subnets        []string                `json:",omitempty"`
+	InstanceTypes  []string                `json:",omitempty"`
+	AmiType        *string                 `json:",omitempty"`
+	CapacityType   *string                 `json:",omitempty"`
+	DiskSize       *int                    `json:",omitempty"`
+	ScalingConfig  *NodeGroupScalingConfig `json:",omitempty"`
+	Labels         map[string]string       `json:",omitempty"`
+	Taints         []Taint                 `json:",omitempty"`
+	ReleaseVersion *string                 `json:",omitempty"`
+	Arn            *string                 `json:",omitempty"`
+	Status         *string                 `json:",omitempty"`
+}
+
+// NodeGroupScalingConfig is autogenerated from the json schema
+type NodeGroupScalingConfig struct {
+	MinSize     *int `json:",omitempty"`
+	MaxSize     *int `json:",omitempty"`
+	DesiredSize *int `json:",omitempty"`
+}
+
+// Taint is autogenerated from the json schema
+type Taint struct {
+	Key    *string `json:",omitempty"`
+	Value  *string `json:",omitempty"`
+	Effect *string `json:",omitempty"`
+}
+
+// Addon is autogenerated from the json schema
+type Addon struct {
+	Name                  *string `json:",omitempty"`
+	Version               *string `json:",omitempty"`
+	ServiceAccountRoleArn *string `json:",omitempty"`
+	ConfigurationValues   *string `json:",omitempty"`
+	ResolveConflicts      *string `json:",omitempty"`
+	Preserve              *bool   `json:",omitempty"`
+}
+
+// ControlPlaneLogging is autogenerated from the json schema
+type ControlPlaneLogging struct {
+	RetentionInDays       *int    `json:",omitempty"`
+	KmsKeyId              *string `json:",omitempty"`
+	Tags                  []Tags  `json:",omitempty"`
+	DeleteOnClusterDelete *bool   `json:",omitempty"`
+}
+
+// KubeConfig is autogenerated from the json schema
+type KubeConfig struct {
+	SecretName *string `json:",omitempty"`
+	RoleArn    *string `json:",omitempty"`
+}
+
+// UpgradePolicy is autogenerated from the json schema
+type UpgradePolicy struct {
+	ReadinessChecks *string `json:",omitempty"`
+}
+
+// VpcConnector is autogenerated from the json schema
+type VpcConnector struct {
+	MemorySize       *int              `json:",omitempty"`
+	Timeout          *int              `json:",omitempty"`
+	Architecture     *string           `json:",omitempty"`
+	SecurityGroupIds []string          `json:",omitempty"`
+	SubnetIds        []string          `json:",omitempty"`
+	Environment      map[string]string `json:",omitempty"`
+	CreateRole       *bool             `json:",omitempty"`
+}
+
+// BootstrapManifest is autogenerated from the json schema
+type BootstrapManifest struct {
+	Content *string `json:",omitempty"`
+	S3Url   *string `json:",omitempty"`
+}
+
 // Tags is autogenerated from the json schema
 type Tags struct {
 	Value *string `json:",omitempty"`
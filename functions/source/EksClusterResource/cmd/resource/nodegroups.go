@@ -0,0 +1,381 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"log"
+	"strings"
+)
+
+func makeCreateNodegroupInput(model *Model, ng NodeGroup) *eks.CreateNodegroupInput {
+	input := &eks.CreateNodegroupInput{
+		ClusterName:    model.Name,
+		NodegroupName:  ng.Name,
+		NodeRole:       ng.NodeRole,
+		AmiType:        ng.AmiType,
+		CapacityType:   ng.CapacityType,
+		ReleaseVersion: ng.ReleaseVersion,
+		ScalingConfig:  createScalingConfig(ng.ScalingConfig),
+		Taints:         createTaints(ng.Taints),
+	}
+	if ng.Subnets != nil {
+		input.Subnets = aws.StringSlice(ng.Subnets)
+	} else {
+		input.Subnets = aws.StringSlice(model.ResourcesVpcConfig.SubnetIds)
+	}
+	if ng.InstanceTypes != nil {
+		input.InstanceTypes = aws.StringSlice(ng.InstanceTypes)
+	}
+	if ng.DiskSize != nil {
+		input.DiskSize = aws.Int64(int64(*ng.DiskSize))
+	}
+	if len(ng.Labels) > 0 {
+		input.Labels = aws.StringMap(ng.Labels)
+	}
+	if model.Tags != nil && len(model.Tags) > 0 {
+		input.Tags = make(map[string]*string)
+		for _, tag := range model.Tags {
+			input.Tags[*tag.Key] = tag.Value
+		}
+	}
+	return input
+}
+
+func createScalingConfig(config *NodeGroupScalingConfig) *eks.NodegroupScalingConfig {
+	if config == nil {
+		return nil
+	}
+	scaling := &eks.NodegroupScalingConfig{}
+	if config.MinSize != nil {
+		scaling.MinSize = aws.Int64(int64(*config.MinSize))
+	}
+	if config.MaxSize != nil {
+		scaling.MaxSize = aws.Int64(int64(*config.MaxSize))
+	}
+	if config.DesiredSize != nil {
+		scaling.DesiredSize = aws.Int64(int64(*config.DesiredSize))
+	}
+	return scaling
+}
+
+func createTaints(taints []Taint) []*eks.Taint {
+	var eksTaints []*eks.Taint
+	for _, t := range taints {
+		eksTaints = append(eksTaints, &eks.Taint{Key: t.Key, Value: t.Value, Effect: t.Effect})
+	}
+	return eksTaints
+}
+
+// reconcileNodeGroups creates missing node groups, applies configuration changes to existing ones and deletes the
+// node groups that were removed from the model since the previous invocation. It is safe to call repeatedly, and
+// returns Complete once every node group has settled in its desired state.
+func reconcileNodeGroups(svc eksiface.EKSAPI, desired *Model, previous *Model) (OperationComplete, error) {
+	complete := Complete
+	for _, name := range removedNodeGroups(previous, desired) {
+		deleted, err := deleteNodeGroup(svc, desired.Name, name)
+		if err != nil {
+			return Complete, err
+		}
+		if !deleted {
+			complete = InProgress
+		}
+	}
+	for i := range desired.NodeGroups {
+		ng := &desired.NodeGroups[i]
+		response, err := svc.DescribeNodegroup(&eks.DescribeNodegroupInput{ClusterName: desired.Name, NodegroupName: ng.Name})
+		if err != nil {
+			if !matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+				return Complete, err
+			}
+			log.Printf("Creating node group %v...\n", *ng.Name)
+			_, err = svc.CreateNodegroup(makeCreateNodegroupInput(desired, *ng))
+			if err != nil {
+				return Complete, err
+			}
+			complete = InProgress
+			continue
+		}
+		current := response.Nodegroup
+		ng.Arn = current.NodegroupArn
+		ng.Status = current.Status
+		if field := immutableNodeGroupChange(*ng, current); field != "" {
+			return Complete, invalidRequestError(fmt.Sprintf("%v of node group %v can't be changed, "+
+				"give the node group a new Name to replace it", field, *ng.Name))
+		}
+		switch *current.Status {
+		case eks.NodegroupStatusActive, eks.NodegroupStatusDegraded:
+			updated, err := updateNodeGroup(svc, desired.Name, *ng, current)
+			if err != nil {
+				return Complete, err
+			}
+			if updated {
+				complete = InProgress
+			}
+		case eks.NodegroupStatusCreateFailed, eks.NodegroupStatusDeleteFailed:
+			return Complete, nodeGroupHealthError(current)
+		default:
+			complete = InProgress
+		}
+	}
+	return complete, nil
+}
+
+// updateNodeGroup issues at most one update for the node group, as EKS rejects concurrent node group updates.
+// It returns true when an update was started.
+func updateNodeGroup(svc eksiface.EKSAPI, clusterName *string, desired NodeGroup, current *eks.Nodegroup) (bool, error) {
+	var err error
+	if input := makeUpdateNodegroupConfigInput(clusterName, desired, current); input != nil {
+		log.Printf("Updating node group %v config...\n", *desired.Name)
+		_, err = svc.UpdateNodegroupConfig(input)
+	} else if desired.ReleaseVersion != nil && *desired.ReleaseVersion != aws.StringValue(current.ReleaseVersion) {
+		log.Printf("Updating node group %v release version to %v...\n", *desired.Name, *desired.ReleaseVersion)
+		_, err = svc.UpdateNodegroupVersion(&eks.UpdateNodegroupVersionInput{
+			ClusterName:    clusterName,
+			NodegroupName:  desired.Name,
+			ReleaseVersion: desired.ReleaseVersion,
+		})
+	} else {
+		return false, nil
+	}
+	if err != nil {
+		if matchesAwsErrorCode(err, eks.ErrCodeResourceInUseException) {
+			return true, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// immutableNodeGroupChange returns the name of the first property of the node group that differs from the existing
+// node group but can only be set when the node group is created, or an empty string if there is none. Properties left
+// unset keep whatever EKS defaulted them to.
+func immutableNodeGroupChange(desired NodeGroup, current *eks.Nodegroup) string {
+	switch {
+	case desired.NodeRole != nil && *desired.NodeRole != aws.StringValue(current.NodeRole):
+		return "NodeRole"
+	case desired.Subnets != nil && !slicesEqual(append([]string(nil), desired.Subnets...), aws.StringValueSlice(current.Subnets)):
+		return "Subnets"
+	case desired.InstanceTypes != nil && !slicesEqual(append([]string(nil), desired.InstanceTypes...), aws.StringValueSlice(current.InstanceTypes)):
+		return "InstanceTypes"
+	case desired.AmiType != nil && *desired.AmiType != aws.StringValue(current.AmiType):
+		return "AmiType"
+	case desired.CapacityType != nil && *desired.CapacityType != aws.StringValue(current.CapacityType):
+		return "CapacityType"
+	case desired.DiskSize != nil && int64(*desired.DiskSize) != aws.Int64Value(current.DiskSize):
+		return "DiskSize"
+	}
+	return ""
+}
+
+func makeUpdateNodegroupConfigInput(clusterName *string, desired NodeGroup, current *eks.Nodegroup) *eks.UpdateNodegroupConfigInput {
+	input := &eks.UpdateNodegroupConfigInput{ClusterName: clusterName, NodegroupName: desired.Name}
+	changed := false
+	if desired.ScalingConfig != nil && scalingChanged(*desired.ScalingConfig, current.ScalingConfig) {
+		input.ScalingConfig = createScalingConfig(desired.ScalingConfig)
+		changed = true
+	}
+	labels := &eks.UpdateLabelsPayload{}
+	for key, value := range desired.Labels {
+		if currentValue, ok := current.Labels[key]; !ok || aws.StringValue(currentValue) != value {
+			if labels.AddOrUpdateLabels == nil {
+				labels.AddOrUpdateLabels = make(map[string]*string)
+			}
+			labels.AddOrUpdateLabels[key] = aws.String(value)
+		}
+	}
+	for key := range current.Labels {
+		if _, ok := desired.Labels[key]; !ok {
+			labels.RemoveLabels = append(labels.RemoveLabels, aws.String(key))
+		}
+	}
+	if labels.AddOrUpdateLabels != nil || labels.RemoveLabels != nil {
+		input.Labels = labels
+		changed = true
+	}
+	taints := &eks.UpdateTaintsPayload{}
+	for _, t := range createTaints(desired.Taints) {
+		if !containsTaint(current.Taints, t) {
+			taints.AddOrUpdateTaints = append(taints.AddOrUpdateTaints, t)
+		}
+	}
+	for _, t := range current.Taints {
+		if !containsTaintKey(desired.Taints, t) {
+			taints.RemoveTaints = append(taints.RemoveTaints, t)
+		}
+	}
+	if taints.AddOrUpdateTaints != nil || taints.RemoveTaints != nil {
+		input.Taints = taints
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return input
+}
+
+func scalingChanged(desired NodeGroupScalingConfig, current *eks.NodegroupScalingConfig) bool {
+	if current == nil {
+		return true
+	}
+	if desired.MinSize != nil && int64(*desired.MinSize) != aws.Int64Value(current.MinSize) {
+		return true
+	}
+	if desired.MaxSize != nil && int64(*desired.MaxSize) != aws.Int64Value(current.MaxSize) {
+		return true
+	}
+	if desired.DesiredSize != nil && int64(*desired.DesiredSize) != aws.Int64Value(current.DesiredSize) {
+		return true
+	}
+	return false
+}
+
+func containsTaint(taints []*eks.Taint, taint *eks.Taint) bool {
+	for _, t := range taints {
+		if aws.StringValue(t.Key) == aws.StringValue(taint.Key) &&
+			aws.StringValue(t.Value) == aws.StringValue(taint.Value) &&
+			aws.StringValue(t.Effect) == aws.StringValue(taint.Effect) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTaintKey(taints []Taint, taint *eks.Taint) bool {
+	for _, t := range taints {
+		if aws.StringValue(t.Key) == aws.StringValue(taint.Key) && aws.StringValue(t.Effect) == aws.StringValue(taint.Effect) {
+			return true
+		}
+	}
+	return false
+}
+
+func removedNodeGroups(previous *Model, desired *Model) []*string {
+	if previous == nil {
+		return nil
+	}
+	var removed []*string
+	for _, p := range previous.NodeGroups {
+		found := false
+		for _, d := range desired.NodeGroups {
+			if *p.Name == *d.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed = append(removed, p.Name)
+		}
+	}
+	return removed
+}
+
+func readNodeGroups(svc eksiface.EKSAPI, model *Model) error {
+	for i := range model.NodeGroups {
+		ng := &model.NodeGroups[i]
+		response, err := svc.DescribeNodegroup(&eks.DescribeNodegroupInput{ClusterName: model.Name, NodegroupName: ng.Name})
+		if err != nil {
+			if matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+				continue
+			}
+			return err
+		}
+		ng.Arn = response.Nodegroup.NodegroupArn
+		ng.Status = response.Nodegroup.Status
+	}
+	return nil
+}
+
+// listNodeRoles returns the node roles of every managed node group of the cluster, including the ones not declared in
+// the model.
+func listNodeRoles(svc eksiface.EKSAPI, clusterName *string) ([]string, error) {
+	var names []*string
+	err := svc.ListNodegroupsPages(&eks.ListNodegroupsInput{ClusterName: clusterName}, func(page *eks.ListNodegroupsOutput, lastPage bool) bool {
+		names = append(names, page.Nodegroups...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	var roles []string
+	for _, name := range names {
+		response, err := svc.DescribeNodegroup(&eks.DescribeNodegroupInput{ClusterName: clusterName, NodegroupName: name})
+		if err != nil {
+			if matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+				continue
+			}
+			return nil, err
+		}
+		if response.Nodegroup.NodeRole != nil {
+			roles = append(roles, *response.Nodegroup.NodeRole)
+		}
+	}
+	return roles, nil
+}
+
+// deleteNodeGroups deletes every managed node group of the cluster, including the ones not declared in the model, as
+// the cluster can't be deleted while any remain. EKS drains the nodes before terminating them.
+func deleteNodeGroups(svc eksiface.EKSAPI, model *Model) (OperationComplete, error) {
+	var names []*string
+	err := svc.ListNodegroupsPages(&eks.ListNodegroupsInput{ClusterName: model.Name}, func(page *eks.ListNodegroupsOutput, lastPage bool) bool {
+		names = append(names, page.Nodegroups...)
+		return true
+	})
+	if err != nil {
+		if matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return Complete, nil
+		}
+		return Complete, err
+	}
+	complete := Complete
+	for _, name := range names {
+		deleted, err := deleteNodeGroup(svc, model.Name, name)
+		if err != nil {
+			return Complete, err
+		}
+		if !deleted {
+			complete = InProgress
+		}
+	}
+	return complete, nil
+}
+
+func deleteNodeGroup(svc eksiface.EKSAPI, clusterName *string, name *string) (OperationComplete, error) {
+	response, err := svc.DescribeNodegroup(&eks.DescribeNodegroupInput{ClusterName: clusterName, NodegroupName: name})
+	if err != nil {
+		if matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return Complete, nil
+		}
+		return Complete, err
+	}
+	switch *response.Nodegroup.Status {
+	case eks.NodegroupStatusDeleting:
+		return InProgress, nil
+	case eks.NodegroupStatusDeleteFailed:
+		return Complete, nodeGroupHealthError(response.Nodegroup)
+	}
+	log.Printf("Deleting node group %v...\n", *name)
+	_, err = svc.DeleteNodegroup(&eks.DeleteNodegroupInput{ClusterName: clusterName, NodegroupName: name})
+	if err != nil {
+		if matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+			return Complete, nil
+		}
+		if matchesAwsErrorCode(err, eks.ErrCodeResourceInUseException) {
+			return InProgress, nil
+		}
+		return Complete, err
+	}
+	return InProgress, nil
+}
+
+func nodeGroupHealthError(ng *eks.Nodegroup) error {
+	var issues []string
+	if ng.Health != nil {
+		for _, issue := range ng.Health.Issues {
+			issues = append(issues, fmt.Sprintf("[%v] %v", aws.StringValue(issue.Code), aws.StringValue(issue.Message)))
+		}
+	}
+	return errors.New(fmt.Sprintf("node group %v status is %v: %v", *ng.NodegroupName, *ng.Status, strings.Join(issues, "; ")))
+}
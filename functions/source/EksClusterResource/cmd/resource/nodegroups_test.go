@@ -0,0 +1,200 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"reflect"
+	"testing"
+)
+
+func testNodegroup() *eks.Nodegroup {
+	return &eks.Nodegroup{
+		NodegroupName: aws.String("workers"),
+		NodeRole:      aws.String("arn:aws:iam::123456789012:role/node"),
+		Subnets:       aws.StringSlice([]string{"subnet-1", "subnet-2"}),
+		InstanceTypes: aws.StringSlice([]string{"t3.medium"}),
+		AmiType:       aws.String(eks.AMITypesAl2X8664),
+		CapacityType:  aws.String(eks.CapacityTypesOnDemand),
+		DiskSize:      aws.Int64(20),
+		ScalingConfig: &eks.NodegroupScalingConfig{MinSize: aws.Int64(1), MaxSize: aws.Int64(3), DesiredSize: aws.Int64(2)},
+		Labels:        aws.StringMap(map[string]string{"team": "platform"}),
+		Taints:        []*eks.Taint{{Key: aws.String("dedicated"), Value: aws.String("platform"), Effect: aws.String(eks.TaintEffectNoSchedule)}},
+		Status:        aws.String(eks.NodegroupStatusActive),
+	}
+}
+
+func TestImmutableNodeGroupChange(t *testing.T) {
+	tests := map[string]struct {
+		desired NodeGroup
+		field   string
+	}{
+		"defaults": {
+			desired: NodeGroup{Name: aws.String("workers")},
+		},
+		"unchanged": {
+			desired: NodeGroup{
+				Name:          aws.String("workers"),
+				NodeRole:      aws.String("arn:aws:iam::123456789012:role/node"),
+				Subnets:       []string{"subnet-2", "subnet-1"},
+				InstanceTypes: []string{"t3.medium"},
+				AmiType:       aws.String(eks.AMITypesAl2X8664),
+				CapacityType:  aws.String(eks.CapacityTypesOnDemand),
+				DiskSize:      aws.Int(20),
+			},
+		},
+		"node role": {
+			desired: NodeGroup{Name: aws.String("workers"), NodeRole: aws.String("arn:aws:iam::123456789012:role/other")},
+			field:   "NodeRole",
+		},
+		"subnets": {
+			desired: NodeGroup{Name: aws.String("workers"), Subnets: []string{"subnet-1", "subnet-3"}},
+			field:   "Subnets",
+		},
+		"instance types": {
+			desired: NodeGroup{Name: aws.String("workers"), InstanceTypes: []string{"m5.large"}},
+			field:   "InstanceTypes",
+		},
+		"ami type": {
+			desired: NodeGroup{Name: aws.String("workers"), AmiType: aws.String(eks.AMITypesBottlerocketX8664)},
+			field:   "AmiType",
+		},
+		"capacity type": {
+			desired: NodeGroup{Name: aws.String("workers"), CapacityType: aws.String(eks.CapacityTypesSpot)},
+			field:   "CapacityType",
+		},
+		"disk size": {
+			desired: NodeGroup{Name: aws.String("workers"), DiskSize: aws.Int(50)},
+			field:   "DiskSize",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if field := immutableNodeGroupChange(tc.desired, testNodegroup()); field != tc.field {
+				t.Errorf("expected %q, got %q", tc.field, field)
+			}
+		})
+	}
+}
+
+func TestMakeUpdateNodegroupConfigInput(t *testing.T) {
+	noSchedule := aws.String(eks.TaintEffectNoSchedule)
+	tests := map[string]struct {
+		desired  NodeGroup
+		expected *eks.UpdateNodegroupConfigInput
+	}{
+		"unchanged": {
+			desired: NodeGroup{
+				Name:          aws.String("workers"),
+				ScalingConfig: &NodeGroupScalingConfig{MinSize: aws.Int(1), MaxSize: aws.Int(3), DesiredSize: aws.Int(2)},
+				Labels:        map[string]string{"team": "platform"},
+				Taints:        []Taint{{Key: aws.String("dedicated"), Value: aws.String("platform"), Effect: noSchedule}},
+			},
+		},
+		"scaling": {
+			desired: NodeGroup{
+				Name:          aws.String("workers"),
+				ScalingConfig: &NodeGroupScalingConfig{MinSize: aws.Int(1), MaxSize: aws.Int(5), DesiredSize: aws.Int(2)},
+				Labels:        map[string]string{"team": "platform"},
+				Taints:        []Taint{{Key: aws.String("dedicated"), Value: aws.String("platform"), Effect: noSchedule}},
+			},
+			expected: &eks.UpdateNodegroupConfigInput{
+				ScalingConfig: &eks.NodegroupScalingConfig{MinSize: aws.Int64(1), MaxSize: aws.Int64(5), DesiredSize: aws.Int64(2)},
+			},
+		},
+		"labels and taints": {
+			desired: NodeGroup{
+				Name:   aws.String("workers"),
+				Labels: map[string]string{"tier": "backend"},
+				Taints: []Taint{{Key: aws.String("dedicated"), Value: aws.String("data"), Effect: noSchedule}},
+			},
+			expected: &eks.UpdateNodegroupConfigInput{
+				Labels: &eks.UpdateLabelsPayload{
+					AddOrUpdateLabels: aws.StringMap(map[string]string{"tier": "backend"}),
+					RemoveLabels:      aws.StringSlice([]string{"team"}),
+				},
+				Taints: &eks.UpdateTaintsPayload{
+					AddOrUpdateTaints: []*eks.Taint{{Key: aws.String("dedicated"), Value: aws.String("data"), Effect: noSchedule}},
+				},
+			},
+		},
+		"taints removed": {
+			desired: NodeGroup{Name: aws.String("workers"), Labels: map[string]string{"team": "platform"}},
+			expected: &eks.UpdateNodegroupConfigInput{
+				Taints: &eks.UpdateTaintsPayload{
+					RemoveTaints: []*eks.Taint{{Key: aws.String("dedicated"), Value: aws.String("platform"), Effect: noSchedule}},
+				},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			input := makeUpdateNodegroupConfigInput(aws.String("cluster"), tc.desired, testNodegroup())
+			if tc.expected != nil {
+				tc.expected.ClusterName = aws.String("cluster")
+				tc.expected.NodegroupName = aws.String("workers")
+			}
+			if !reflect.DeepEqual(input, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, input)
+			}
+		})
+	}
+}
+
+type mockNodegroupClient struct {
+	mockEKSClient
+	nodegroup     *eks.Nodegroup
+	configUpdates []*eks.UpdateNodegroupConfigInput
+}
+
+func (m *mockNodegroupClient) DescribeNodegroup(*eks.DescribeNodegroupInput) (*eks.DescribeNodegroupOutput, error) {
+	return &eks.DescribeNodegroupOutput{Nodegroup: m.nodegroup}, nil
+}
+
+func (m *mockNodegroupClient) UpdateNodegroupConfig(input *eks.UpdateNodegroupConfigInput) (*eks.UpdateNodegroupConfigOutput, error) {
+	m.configUpdates = append(m.configUpdates, input)
+	return &eks.UpdateNodegroupConfigOutput{}, nil
+}
+
+func TestReconcileNodeGroups(t *testing.T) {
+	tests := map[string]struct {
+		nodeGroup NodeGroup
+		complete  OperationComplete
+		updates   int
+		invalid   bool
+	}{
+		"unchanged": {
+			nodeGroup: NodeGroup{Name: aws.String("workers"), Labels: map[string]string{"team": "platform"},
+				Taints: []Taint{{Key: aws.String("dedicated"), Value: aws.String("platform"), Effect: aws.String(eks.TaintEffectNoSchedule)}}},
+			complete: Complete,
+		},
+		"updated in place": {
+			nodeGroup: NodeGroup{Name: aws.String("workers")},
+			complete:  InProgress,
+			updates:   1,
+		},
+		"immutable change": {
+			nodeGroup: NodeGroup{Name: aws.String("workers"), InstanceTypes: []string{"m5.large"}},
+			invalid:   true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockNodegroupClient{nodegroup: testNodegroup()}
+			model := testModel("1.23")
+			model.NodeGroups = []NodeGroup{tc.nodeGroup}
+			complete, err := reconcileNodeGroups(svc, model, model)
+			if tc.invalid {
+				if !matchesAwsErrorCode(err, eks.ErrCodeInvalidParameterException) || len(svc.configUpdates) > 0 {
+					t.Errorf("expected an invalid request error without updates, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if complete != tc.complete || len(svc.configUpdates) != tc.updates {
+				t.Errorf("expected complete %v after %v updates, got %v after %v", tc.complete, tc.updates, complete, len(svc.configUpdates))
+			}
+		})
+	}
+}
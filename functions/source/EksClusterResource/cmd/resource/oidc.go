@@ -0,0 +1,139 @@
+package resource
+
+import (
+	"crypto/sha1"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	oidcClientId = "sts.amazonaws.com"
+	// marks providers created by this resource type, the only ones it deletes
+	oidcProviderManagedTag = "awsqs.eks/managed"
+)
+
+func createsOIDCProvider(model *Model) bool {
+	return model.CreateOIDCProvider != nil && *model.CreateOIDCProvider
+}
+
+// oidcProviderArn derives the ARN IAM assigns to the OpenID Connect provider of the cluster's issuer.
+func oidcProviderArn(clusterArn *string, issuer *string) *string {
+	if clusterArn == nil || issuer == nil {
+		return nil
+	}
+	return aws.String(fmt.Sprintf("arn:%s:iam::%s:oidc-provider/%s", *partitionFromArn(clusterArn), *accountIdFromArn(clusterArn),
+		strings.TrimPrefix(*issuer, "https://")))
+}
+
+func putOIDCProvider(svc iamiface.IAMAPI, eksSvc eksiface.EKSAPI, model *Model) error {
+	response, err := eksSvc.DescribeCluster(&eks.DescribeClusterInput{Name: model.Name})
+	if err != nil {
+		return err
+	}
+	if response.Cluster.Identity == nil || response.Cluster.Identity.Oidc == nil {
+		return errors.New("cluster has no OpenID Connect issuer")
+	}
+	issuer := response.Cluster.Identity.Oidc.Issuer
+	arn := oidcProviderArn(response.Cluster.Arn, issuer)
+	model.OIDCIssuerURL = issuer
+	existing, err := svc.GetOpenIDConnectProvider(&iam.GetOpenIDConnectProviderInput{OpenIDConnectProviderArn: arn})
+	if err == nil {
+		if !hasTag(existing.Tags, oidcProviderManagedTag) {
+			log.Printf("Using existing IAM OIDC provider %v, which won't be deleted with the cluster\n", *arn)
+		}
+		model.OIDCProviderArn = arn
+		return nil
+	}
+	if !matchesAwsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+		return err
+	}
+	thumbprint, err := getIssuerThumbprint(*issuer)
+	if err != nil {
+		return err
+	}
+	input := &iam.CreateOpenIDConnectProviderInput{
+		Url:            issuer,
+		ClientIDList:   aws.StringSlice([]string{oidcClientId}),
+		ThumbprintList: aws.StringSlice([]string{thumbprint}),
+		Tags:           []*iam.Tag{{Key: aws.String(oidcProviderManagedTag), Value: aws.String("true")}},
+	}
+	for _, tag := range model.Tags {
+		input.Tags = append(input.Tags, &iam.Tag{Key: tag.Key, Value: tag.Value})
+	}
+	log.Printf("Creating IAM OIDC provider for %v...\n", *issuer)
+	_, err = svc.CreateOpenIDConnectProvider(input)
+	// a provider created concurrently by someone else isn't tagged, so it isn't deleted with the cluster
+	if err != nil && !matchesAwsErrorCode(err, iam.ErrCodeEntityAlreadyExistsException) {
+		return err
+	}
+	model.OIDCProviderArn = arn
+	return nil
+}
+
+// getIssuerThumbprint returns the SHA-1 fingerprint of the root certificate served by the issuer's host.
+func getIssuerThumbprint(issuer string) (string, error) {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return "", err
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(u.Hostname(), "443"), &tls.Config{ServerName: u.Hostname()})
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", fmt.Errorf("no certificates presented by %v", u.Hostname())
+	}
+	return fmt.Sprintf("%x", sha1.Sum(certs[len(certs)-1].Raw)), nil
+}
+
+// deleteOIDCProvider deletes the OpenID Connect provider of the cluster's issuer if this resource type created it.
+func deleteOIDCProvider(svc iamiface.IAMAPI, eksSvc eksiface.EKSAPI, model *Model) error {
+	arn := model.OIDCProviderArn
+	if arn == nil {
+		response, err := eksSvc.DescribeCluster(&eks.DescribeClusterInput{Name: model.Name})
+		if err != nil {
+			if matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+				return nil
+			}
+			return err
+		}
+		if response.Cluster.Identity == nil || response.Cluster.Identity.Oidc == nil {
+			return nil
+		}
+		arn = oidcProviderArn(response.Cluster.Arn, response.Cluster.Identity.Oidc.Issuer)
+	}
+	existing, err := svc.GetOpenIDConnectProvider(&iam.GetOpenIDConnectProviderInput{OpenIDConnectProviderArn: arn})
+	if err != nil {
+		if matchesAwsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+			model.OIDCProviderArn = nil
+			return nil
+		}
+		return err
+	}
+	if !hasTag(existing.Tags, oidcProviderManagedTag) {
+		log.Printf("Leaving IAM OIDC provider %v, which was not created by this resource type\n", *arn)
+		model.OIDCProviderArn = nil
+		return nil
+	}
+	log.Printf("Deleting IAM OIDC provider %v...\n", *arn)
+	_, err = svc.DeleteOpenIDConnectProvider(&iam.DeleteOpenIDConnectProviderInput{OpenIDConnectProviderArn: arn})
+	if err != nil && !matchesAwsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+		return err
+	}
+	model.OIDCProviderArn = nil
+	return nil
+}
@@ -0,0 +1,54 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"testing"
+)
+
+type mockIAMClient struct {
+	iamiface.IAMAPI
+	providerTags []*iam.Tag
+	deleted      []string
+}
+
+func (m *mockIAMClient) GetOpenIDConnectProvider(*iam.GetOpenIDConnectProviderInput) (*iam.GetOpenIDConnectProviderOutput, error) {
+	return &iam.GetOpenIDConnectProviderOutput{Tags: m.providerTags}, nil
+}
+
+func (m *mockIAMClient) DeleteOpenIDConnectProvider(input *iam.DeleteOpenIDConnectProviderInput) (*iam.DeleteOpenIDConnectProviderOutput, error) {
+	m.deleted = append(m.deleted, *input.OpenIDConnectProviderArn)
+	return &iam.DeleteOpenIDConnectProviderOutput{}, nil
+}
+
+func TestDeleteOIDCProvider(t *testing.T) {
+	arn := "arn:aws:iam::123456789012:oidc-provider/oidc.eks.us-east-1.amazonaws.com/id/EXAMPLE"
+	tests := map[string]struct {
+		tags    []*iam.Tag
+		deletes bool
+	}{
+		"created by the resource": {
+			tags:    []*iam.Tag{{Key: aws.String(oidcProviderManagedTag), Value: aws.String("true")}},
+			deletes: true,
+		},
+		"existing provider": {
+			tags: []*iam.Tag{{Key: aws.String("team"), Value: aws.String("platform")}},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockIAMClient{providerTags: tc.tags}
+			model := &Model{Name: aws.String("cluster"), OIDCProviderArn: aws.String(arn)}
+			if err := deleteOIDCProvider(svc, nil, model); err != nil {
+				t.Fatal(err)
+			}
+			if deleted := len(svc.deleted) > 0; deleted != tc.deletes {
+				t.Errorf("expected deleted to be %v, got %v", tc.deletes, deleted)
+			}
+			if model.OIDCProviderArn != nil {
+				t.Errorf("expected OIDCProviderArn to be cleared")
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"k8s.io/client-go/kubernetes"
+	"log"
+	"strings"
+)
+
+const (
+	readinessChecksWarn  = "WARN"
+	deprecatedApisMetric = "apiserver_requested_deprecated_apis"
+)
+
+// warnsOnReadinessFailures reports whether failed readiness checks should be reported as warnings rather than block
+// the upgrade.
+func warnsOnReadinessFailures(model *Model) bool {
+	if model.UpgradePolicy == nil || model.UpgradePolicy.ReadinessChecks == nil {
+		return false
+	}
+	return *model.UpgradePolicy.ReadinessChecks == readinessChecksWarn
+}
+
+// checkUpgradeReadiness returns the reasons the cluster can't safely be upgraded to version: failing EKS upgrade
+// insights, requests to APIs that are removed in version, and installed add-ons that have no build for version.
+func checkUpgradeReadiness(sess *session.Session, svc eksiface.EKSAPI, model *Model, version string) ([]string, error) {
+	failures, err := upgradeInsightFailures(svc, model.Name, version)
+	if err != nil {
+		return nil, err
+	}
+	addonFailures, err := addonCompatibilityFailures(svc, model.Name, version)
+	if err != nil {
+		return nil, err
+	}
+	failures = append(failures, addonFailures...)
+	if isPrivate(model) {
+		// the API server isn't reachable from the handler, EKS upgrade insights cover deprecated APIs for these
+		log.Println("Skipping deprecated API check, cluster endpoint is private")
+		return failures, nil
+	}
+	clientset, err := CreateKubeClientEks(sess, svc, model.Name)
+	if err != nil {
+		return nil, err
+	}
+	apiFailures, err := deprecatedApiFailures(clientset, version)
+	if err != nil {
+		// the metrics can be restricted by RBAC or unavailable for a while, which shouldn't block upgrades
+		log.Printf("WARNING: could not check for deprecated API usage: %v\n", err)
+	}
+	return append(failures, apiFailures...), nil
+}
+
+func upgradeInsightFailures(svc eksiface.EKSAPI, clusterName *string, version string) ([]string, error) {
+	var failures []string
+	input := &eks.ListInsightsInput{
+		ClusterName: clusterName,
+		Filter: &eks.InsightsFilter{
+			Categories:         aws.StringSlice([]string{eks.CategoryUpgradeReadiness}),
+			KubernetesVersions: aws.StringSlice([]string{version}),
+		},
+	}
+	err := svc.ListInsightsPages(input, func(page *eks.ListInsightsOutput, lastPage bool) bool {
+		for _, insight := range page.Insights {
+			if insight.InsightStatus == nil {
+				continue
+			}
+			switch aws.StringValue(insight.InsightStatus.Status) {
+			case eks.InsightStatusValueWarning, eks.InsightStatusValueError:
+				failures = append(failures, fmt.Sprintf("insight %q is %v: %v", aws.StringValue(insight.Name),
+					aws.StringValue(insight.InsightStatus.Status), aws.StringValue(insight.InsightStatus.Reason)))
+			}
+		}
+		return true
+	})
+	return failures, err
+}
+
+func addonCompatibilityFailures(svc eksiface.EKSAPI, clusterName *string, version string) ([]string, error) {
+	var names []*string
+	err := svc.ListAddonsPages(&eks.ListAddonsInput{ClusterName: clusterName}, func(page *eks.ListAddonsOutput, lastPage bool) bool {
+		names = append(names, page.Addons...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	var failures []string
+	for _, name := range names {
+		response, err := svc.DescribeAddon(&eks.DescribeAddonInput{ClusterName: clusterName, AddonName: name})
+		if err != nil {
+			return nil, err
+		}
+		current := aws.StringValue(response.Addon.AddonVersion)
+		compatible := false
+		input := &eks.DescribeAddonVersionsInput{AddonName: name, KubernetesVersion: aws.String(version)}
+		err = svc.DescribeAddonVersionsPages(input, func(page *eks.DescribeAddonVersionsOutput, lastPage bool) bool {
+			for _, info := range page.Addons {
+				for _, v := range info.AddonVersions {
+					if aws.StringValue(v.AddonVersion) == current {
+						compatible = true
+					}
+				}
+			}
+			return !compatible
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !compatible {
+			failures = append(failures, fmt.Sprintf("add-on %v version %v is not compatible with Kubernetes %v", *name, current, version))
+		}
+	}
+	return failures, nil
+}
+
+// deprecatedApiFailures reads the API server's deprecated API request counters and returns the APIs that have been
+// requested and are removed in version or earlier.
+func deprecatedApiFailures(clientset *kubernetes.Clientset, version string) ([]string, error) {
+	metrics, err := clientset.Discovery().RESTClient().Get().AbsPath("/metrics").DoRaw(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	major, minor, err := parseVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	var failures []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(metrics))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, deprecatedApisMetric+"{") {
+			continue
+		}
+		labels := parseMetricLabels(line)
+		removedMajor, removedMinor, err := parseVersion(labels["removed_release"])
+		if err != nil || removedMajor > major || (removedMajor == major && removedMinor > minor) {
+			continue
+		}
+		api := labels["resource"] + "." + labels["version"]
+		if labels["group"] != "" {
+			api += "." + labels["group"]
+		}
+		if seen[api] {
+			continue
+		}
+		seen[api] = true
+		failures = append(failures, fmt.Sprintf("API %v is removed in Kubernetes %v and still in use", api, labels["removed_release"]))
+	}
+	return failures, scanner.Err()
+}
+
+// parseMetricLabels returns the labels of a line in the Prometheus text format.
+func parseMetricLabels(line string) map[string]string {
+	labels := make(map[string]string)
+	start := strings.Index(line, "{")
+	end := strings.LastIndex(line, "}")
+	if start < 0 || end < start {
+		return labels
+	}
+	for _, pair := range strings.Split(line[start+1:end], ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		labels[strings.TrimSpace(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+	return labels
+}
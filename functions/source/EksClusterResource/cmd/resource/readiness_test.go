@@ -0,0 +1,164 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseMetricLabels(t *testing.T) {
+	tests := map[string]struct {
+		line     string
+		expected map[string]string
+	}{
+		"labels": {
+			line: `apiserver_requested_deprecated_apis{group="policy",removed_release="1.25",resource="podsecuritypolicies",subresource="",version="v1beta1"} 1`,
+			expected: map[string]string{
+				"group":           "policy",
+				"removed_release": "1.25",
+				"resource":        "podsecuritypolicies",
+				"subresource":     "",
+				"version":         "v1beta1",
+			},
+		},
+		"no labels": {
+			line:     "apiserver_requested_deprecated_apis 1",
+			expected: map[string]string{},
+		},
+		"malformed pair": {
+			line:     `apiserver_requested_deprecated_apis{group,version="v1"} 1`,
+			expected: map[string]string{"version": "v1"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if labels := parseMetricLabels(tc.line); !reflect.DeepEqual(labels, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, labels)
+			}
+		})
+	}
+}
+
+// metricsServer serves metrics on /metrics, or fails with status when it isn't 200.
+func metricsServer(t *testing.T, status int, metrics string) *kubernetes.Clientset {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(metrics))
+	}))
+	t.Cleanup(server.Close)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientset
+}
+
+func TestDeprecatedApiFailures(t *testing.T) {
+	metrics := `# HELP apiserver_requested_deprecated_apis Gauge of deprecated APIs that have been requested
+# TYPE apiserver_requested_deprecated_apis gauge
+apiserver_requested_deprecated_apis{group="policy",removed_release="1.25",resource="podsecuritypolicies",subresource="",version="v1beta1"} 1
+apiserver_requested_deprecated_apis{group="policy",removed_release="1.25",resource="podsecuritypolicies",subresource="status",version="v1beta1"} 1
+apiserver_requested_deprecated_apis{group="flowcontrol.apiserver.k8s.io",removed_release="1.26",resource="flowschemas",subresource="",version="v1beta1"} 1
+apiserver_requested_deprecated_apis{group="",removed_release="",resource="componentstatuses",subresource="",version="v1"} 1
+apiserver_request_total{code="200",resource="pods",verb="GET",version="v1"} 10
+`
+	tests := map[string]struct {
+		status   int
+		version  string
+		expected []string
+		failed   bool
+	}{
+		"removed in the target version": {
+			status:   http.StatusOK,
+			version:  "1.25",
+			expected: []string{"API podsecuritypolicies.v1beta1.policy is removed in Kubernetes 1.25 and still in use"},
+		},
+		"removed in the target version and earlier": {
+			status:  http.StatusOK,
+			version: "1.26",
+			expected: []string{
+				"API podsecuritypolicies.v1beta1.policy is removed in Kubernetes 1.25 and still in use",
+				"API flowschemas.v1beta1.flowcontrol.apiserver.k8s.io is removed in Kubernetes 1.26 and still in use",
+			},
+		},
+		"removed in later versions": {
+			status:  http.StatusOK,
+			version: "1.24",
+		},
+		"metrics forbidden": {
+			status:  http.StatusForbidden,
+			version: "1.25",
+			failed:  true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			failures, err := deprecatedApiFailures(metricsServer(t, tc.status, metrics), tc.version)
+			if tc.failed {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(failures, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, failures)
+			}
+		})
+	}
+}
+
+func TestUpgradeClusterVersionReadiness(t *testing.T) {
+	insights := []*eks.InsightSummary{{
+		Name:          aws.String("Deprecated APIs removed in Kubernetes v1.23"),
+		InsightStatus: &eks.InsightStatus{Status: aws.String(eks.InsightStatusValueError), Reason: aws.String("deprecated APIs in use")},
+	}}
+	tests := map[string]struct {
+		insights []*eks.InsightSummary
+		policy   *UpgradePolicy
+		updates  []string
+		invalid  bool
+	}{
+		"ready": {
+			updates: []string{"1.23"},
+		},
+		"blocked": {
+			insights: insights,
+			invalid:  true,
+		},
+		"warned": {
+			insights: insights,
+			policy:   &UpgradePolicy{ReadinessChecks: aws.String(readinessChecksWarn)},
+			updates:  []string{"1.23"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockEKSClient{cluster: testCluster("ACTIVE", "1.22"), insights: tc.insights}
+			model := testModel("1.23")
+			model.UpgradePolicy = tc.policy
+			_, err := upgradeClusterVersion(nil, svc, model, &versionUpgrade{})
+			if tc.invalid {
+				if !matchesAwsErrorCode(err, eks.ErrCodeInvalidParameterException) {
+					t.Errorf("expected an invalid request error, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(svc.versionUpdates, tc.updates) {
+				t.Errorf("expected version updates %v, got %v", tc.updates, svc.versionUpdates)
+			}
+		})
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"log"
 	"runtime/debug"
 	"strings"
@@ -12,6 +16,9 @@ import (
 
 func Create(req handler.Request, _ *Model, model *Model) (handler.ProgressEvent, error) {
 	defer logPanic()
+	if model.Name == nil {
+		model.Name = getClusterName(req.CallbackContext)
+	}
 	stage := getStage(req.CallbackContext)
 	switch stage {
 	case InitStage:
@@ -26,12 +33,36 @@ func Create(req handler.Request, _ *Model, model *Model) (handler.ProgressEvent,
 	case ClusterStablilize:
 		log.Println("Starting ClusterStablilizeStage...")
 		return createClusterStabilize(req, model), nil
+	case OIDCProviderStage:
+		log.Println("Starting OIDCProviderStage...")
+		return createOIDCProviderHandler(req, model), nil
+	case FargateProfileStage:
+		log.Println("Starting FargateProfileStage...")
+		return createFargateProfilesHandler(req, model), nil
+	case NodeGroupStage:
+		log.Println("Starting NodeGroupStage...")
+		return createNodeGroupsHandler(req, model), nil
+	case AddonStage:
+		log.Println("Starting AddonStage...")
+		return createAddonsHandler(req, model), nil
+	case AccessEntryStage:
+		log.Println("Starting AccessEntryStage...")
+		return createAccessEntriesHandler(req, model), nil
+	case IdentityProviderStage:
+		log.Println("Starting IdentityProviderStage...")
+		return createIdentityProvidersHandler(req, model), nil
 	case IamAuthStage:
 		log.Println("Starting IamAuthStage...")
 		return createIamAuthHandler(req, model), nil
+	case BootstrapManifestStage:
+		log.Println("Starting BootstrapManifestStage...")
+		return createBootstrapManifestsHandler(req, model), nil
 	case UpdateClusterStage:
 		log.Println("Starting UpdateClusterStage...")
 		return createFinalize(req, model), nil
+	case KubeConfigStage:
+		log.Println("Starting KubeConfigStage...")
+		return createKubeConfigHandler(req, model), nil
 	default:
 		log.Println("Failed to identify stage.")
 		return errorEvent(model, errors.New(fmt.Sprintf("Unhandled stage %s", stage))), nil
@@ -39,12 +70,34 @@ func Create(req handler.Request, _ *Model, model *Model) (handler.ProgressEvent,
 }
 
 func createInit(req handler.Request, model *Model) handler.ProgressEvent {
+	if err := validateModel(model); err != nil {
+		return errorEvent(model, err)
+	}
+	createId := getCreateId(req.CallbackContext)
+	if createId == nil {
+		// the first invocation only names the create, the cluster is created by the next one
+		id, err := newCreateId()
+		if err != nil {
+			return errorEvent(model, err)
+		}
+		if model.Name == nil {
+			model.Name = generateClusterName(req.LogicalResourceID, createRequestSeed(model, req.RequestContext.StackID, req.LogicalResourceID, id))
+		}
+		return createIdEvent(model, id)
+	}
+	if managesLogGroup(model) {
+		err := putLogGroup(cloudwatchlogs.New(req.Session), model)
+		if err != nil {
+			return errorEvent(model, err)
+		}
+	}
+	token := clientRequestToken(createRequestSeed(model, req.RequestContext.StackID, req.LogicalResourceID, *createId))
 	eksClient := eks.New(req.Session)
-	if model.Name == nil {
-		model.Name = generateClusterName()
+	_, err := createCluster(eksClient, model, token, false)
+	if err != nil && matchesAwsErrorCode(err, eks.ErrCodeResourceInUseException) && adoptsExistingCluster(model) {
+		err = adoptCluster(eksClient, model)
 	}
-	_, err := createCluster(eksClient, model, false)
-	if isPrivate(model) {
+	if isPrivate(model) && usesConfigMap(model) {
 		return makeEvent(model, LambdaInitStage, err)
 	} else {
 		return makeEvent(model, ClusterStablilize, err)
@@ -52,7 +105,17 @@ func createInit(req handler.Request, model *Model) handler.ProgressEvent {
 }
 
 func initLambda(req handler.Request, model *Model) handler.ProgressEvent {
+	if createsConnectorRole(model) {
+		err := putConnectorRole(iam.New(req.Session), model, *req.Session.Config.Region)
+		if err != nil {
+			return errorEvent(model, err)
+		}
+	}
 	_, err := putFunction(req.Session, model, false)
+	if err != nil && roleNotAssumable(err) {
+		// a role that was just created takes a while to become usable by Lambda
+		return makeEvent(model, LambdaInitStage, nil)
+	}
 	return makeEvent(model, LambdaStablilize, err)
 }
 
@@ -66,14 +129,67 @@ func createLambdaStabilize(req handler.Request, model *Model) handler.ProgressEv
 
 func createClusterStabilize(req handler.Request, model *Model) handler.ProgressEvent {
 	eksClient := eks.New(req.Session)
-	clusterComplete, err := createCluster(eksClient, model, true)
+	clusterComplete, err := createCluster(eksClient, model, nil, true)
 	if clusterComplete {
-		return makeEvent(model, IamAuthStage, err)
+		return makeEvent(model, OIDCProviderStage, err)
 	}
 	return makeEvent(model, ClusterStablilize, err)
 }
 
+func createOIDCProviderHandler(req handler.Request, model *Model) handler.ProgressEvent {
+	if !createsOIDCProvider(model) {
+		return makeEvent(model, FargateProfileStage, nil)
+	}
+	err := putOIDCProvider(iam.New(req.Session), eks.New(req.Session), model)
+	return makeEvent(model, FargateProfileStage, err)
+}
+
+func createFargateProfilesHandler(req handler.Request, model *Model) handler.ProgressEvent {
+	eksClient := eks.New(req.Session)
+	profilesComplete, err := reconcileFargateProfiles(eksClient, model, nil)
+	if profilesComplete {
+		return makeEvent(model, NodeGroupStage, err)
+	}
+	return makeEvent(model, FargateProfileStage, err)
+}
+
+func createNodeGroupsHandler(req handler.Request, model *Model) handler.ProgressEvent {
+	eksClient := eks.New(req.Session)
+	nodeGroupsComplete, err := reconcileNodeGroups(eksClient, model, nil)
+	if nodeGroupsComplete {
+		return makeEvent(model, AddonStage, err)
+	}
+	return makeEvent(model, NodeGroupStage, err)
+}
+
+func createAddonsHandler(req handler.Request, model *Model) handler.ProgressEvent {
+	eksClient := eks.New(req.Session)
+	addonsComplete, err := reconcileAddons(eksClient, model, nil)
+	if addonsComplete {
+		return makeEvent(model, AccessEntryStage, err)
+	}
+	return makeEvent(model, AddonStage, err)
+}
+
+func createAccessEntriesHandler(req handler.Request, model *Model) handler.ProgressEvent {
+	eksClient := eks.New(req.Session)
+	err := reconcileAccessEntries(eksClient, model, nil)
+	return makeEvent(model, IdentityProviderStage, err)
+}
+
+func createIdentityProvidersHandler(req handler.Request, model *Model) handler.ProgressEvent {
+	eksClient := eks.New(req.Session)
+	configsComplete, err := reconcileIdentityProviderConfigs(eksClient, model, nil)
+	if configsComplete {
+		return makeEvent(model, IamAuthStage, err)
+	}
+	return makeEvent(model, IdentityProviderStage, err)
+}
+
 func createIamAuthHandler(req handler.Request, model *Model) handler.ProgressEvent {
+	if !usesConfigMap(model) {
+		return makeEvent(model, BootstrapManifestStage, nil)
+	}
 	eksClient := eks.New(req.Session)
 	err := createIamAuth(req.Session, eksClient, model)
 	if err != nil {
@@ -82,33 +198,76 @@ func createIamAuthHandler(req handler.Request, model *Model) handler.ProgressEve
 		}
 		panic(err)
 	}
+	return makeEvent(model, BootstrapManifestStage, err)
+}
+
+func createBootstrapManifestsHandler(req handler.Request, model *Model) handler.ProgressEvent {
+	if len(model.BootstrapManifests) == 0 {
+		return makeEvent(model, UpdateClusterStage, nil)
+	}
+	err := applyBootstrapManifests(req.Session, eks.New(req.Session), model, model.BootstrapManifests, bootstrapsPrivately(model))
+	if err != nil && strings.Contains(err.Error(), "i/o timeout") {
+		return makeEvent(model, BootstrapManifestStage, nil)
+	}
 	return makeEvent(model, UpdateClusterStage, err)
 }
 
 func createFinalize(req handler.Request, model *Model) handler.ProgressEvent {
 	// Call update cluster to apply disabled public endpoint and access cidr
 	eksClient := eks.New(req.Session)
-	clusterComplete, err := updateCluster(eksClient, model)
+	clusterComplete, updateId, err := updateCluster(eksClient, model, getUpdateId(req.CallbackContext))
 	if err != nil {
 		return errorEvent(model, err)
 	}
 	if clusterComplete {
-		return makeEvent(model, CompleteStage, err)
+		return makeEvent(model, KubeConfigStage, err)
 	}
-	return makeEvent(model, UpdateClusterStage, err)
+	return updateClusterEvent(model, updateId)
+}
+
+func createKubeConfigHandler(req handler.Request, model *Model) handler.ProgressEvent {
+	if !exportsKubeConfig(model) {
+		return makeEvent(model, CompleteStage, nil)
+	}
+	err := putKubeConfigSecret(secretsmanager.New(req.Session), eks.New(req.Session), model)
+	return makeEvent(model, CompleteStage, err)
 }
 
 func Read(req handler.Request, _ *Model, model *Model) (handler.ProgressEvent, error) {
 	defer logPanic()
 	svc := eks.New(req.Session)
-	progress := readCluster(svc, model)
+	progress := readCluster(req.Session, svc, model)
 	return progress, nil
 }
 
-func Update(req handler.Request, _ *Model, model *Model) (handler.ProgressEvent, error) {
+func Update(req handler.Request, prevModel *Model, model *Model) (handler.ProgressEvent, error) {
 	defer logPanic()
+	if err := validateModel(model); err != nil {
+		return errorEvent(model, err), nil
+	}
 	eksClient := eks.New(req.Session)
-	clusterComplete, err := updateCluster(eksClient, model)
+	stage := getStage(req.CallbackContext)
+	if stage == InitStage || stage == VersionUpgradeStage {
+		upgrade := getVersionUpgrade(req.CallbackContext)
+		versionComplete, err := upgradeClusterVersion(req.Session, eksClient, model, upgrade)
+		if err != nil {
+			return errorEvent(model, err), nil
+		}
+		if !versionComplete {
+			return versionUpgradeEvent(model, upgrade), nil
+		}
+	}
+	if managesLogGroup(model) {
+		err := putLogGroup(cloudwatchlogs.New(req.Session), model)
+		if err != nil {
+			return errorEvent(model, err), nil
+		}
+	}
+	var updateId *string
+	if stage == UpdateClusterStage {
+		updateId = getUpdateId(req.CallbackContext)
+	}
+	clusterComplete, updateId, err := updateCluster(eksClient, model, updateId)
 	if err != nil {
 		if matchesAwsErrorCode(err, eks.ErrCodeResourceNotFoundException) {
 
@@ -116,40 +275,200 @@ func Update(req handler.Request, _ *Model, model *Model) (handler.ProgressEvent,
 		return errorEvent(model, err), nil
 	}
 	var functionComplete OperationComplete = true
-	if isPrivate(model) {
+	if isPrivate(model) && usesConfigMap(model) {
+		if createsConnectorRole(model) {
+			err = putConnectorRole(iam.New(req.Session), model, *req.Session.Config.Region)
+			if err != nil {
+				return errorEvent(model, err), nil
+			}
+		}
 		functionComplete, err = putFunction(req.Session, model, false)
+		if err != nil && roleNotAssumable(err) {
+			functionComplete, err = InProgress, nil
+		}
 		if err != nil {
 			return errorEvent(model, err), nil
 		}
 	}
 	if clusterComplete && functionComplete {
-		err = updateIamAuth(req.Session, eksClient, model)
+		if createsOIDCProvider(model) {
+			err = putOIDCProvider(iam.New(req.Session), eksClient, model)
+		} else if createsOIDCProvider(prevModel) {
+			err = deleteOIDCProvider(iam.New(req.Session), eksClient, prevModel)
+		}
+		if err != nil {
+			return errorEvent(model, err), nil
+		}
+		profilesComplete, err := reconcileFargateProfiles(eksClient, model, prevModel)
+		if err != nil {
+			return errorEvent(model, err), nil
+		}
+		if !profilesComplete {
+			return inProgressEvent(model, FargateProfileStage), nil
+		}
+		nodeGroupsComplete, err := reconcileNodeGroups(eksClient, model, prevModel)
+		if err != nil {
+			return errorEvent(model, err), nil
+		}
+		if !nodeGroupsComplete {
+			return inProgressEvent(model, NodeGroupStage), nil
+		}
+		addonsComplete, err := reconcileAddons(eksClient, model, prevModel)
+		if err != nil {
+			return errorEvent(model, err), nil
+		}
+		if !addonsComplete {
+			return inProgressEvent(model, AddonStage), nil
+		}
+		err = reconcileAccessEntries(eksClient, model, prevModel)
+		if err != nil {
+			return errorEvent(model, err), nil
+		}
+		configsComplete, err := reconcileIdentityProviderConfigs(eksClient, model, prevModel)
 		if err != nil {
 			return errorEvent(model, err), nil
 		}
+		if !configsComplete {
+			return inProgressEvent(model, IdentityProviderStage), nil
+		}
+		if usesConfigMap(model) {
+			err = updateIamAuth(req.Session, eksClient, model)
+			if err != nil {
+				return errorEvent(model, err), nil
+			}
+		}
+		if manifests := changedBootstrapManifests(model, prevModel); len(manifests) > 0 {
+			err = applyBootstrapManifests(req.Session, eksClient, model, manifests, isPrivate(model))
+			if err != nil {
+				return errorEvent(model, err), nil
+			}
+		}
+		if createsConnectorRole(prevModel) && (!createsConnectorRole(model) || *connectorRoleName(prevModel) != *connectorRoleName(model)) {
+			err = releaseConnectorRole(iam.New(req.Session), prevModel, *req.Session.Config.Region)
+			if err != nil {
+				return errorEvent(model, err), nil
+			}
+		}
+		secretsClient := secretsmanager.New(req.Session)
+		if exportsKubeConfig(prevModel) && (!exportsKubeConfig(model) || *kubeConfigSecretName(prevModel) != *kubeConfigSecretName(model)) {
+			err = deleteKubeConfigSecret(secretsClient, prevModel)
+			if err != nil {
+				return errorEvent(model, err), nil
+			}
+		}
+		if exportsKubeConfig(model) {
+			err = putKubeConfigSecret(secretsClient, eksClient, model)
+			if err != nil {
+				return errorEvent(model, err), nil
+			}
+		}
 		return successEvent(model), nil
 	}
-	return inProgressEvent(model, UpdateClusterStage), nil
+	return updateClusterEvent(model, updateId), nil
 }
 
 func Delete(req handler.Request, _ *Model, model *Model) (handler.ProgressEvent, error) {
 	defer logPanic()
-	if isPrivate(model) {
-		err := deleteFunction(req.Session, model, req.CallbackContext)
+	stage := getStage(req.CallbackContext)
+	switch stage {
+	case InitStage:
+		log.Println("Starting delete InitStage...")
+		return deleteInit(req, model), nil
+	case DeleteNodeGroupStage:
+		log.Println("Starting DeleteNodeGroupStage...")
+		return deleteNodeGroupsHandler(req, model), nil
+	case DeleteFargateProfileStage:
+		log.Println("Starting DeleteFargateProfileStage...")
+		return deleteFargateProfilesHandler(req, model), nil
+	case DeleteAddonStage:
+		log.Println("Starting DeleteAddonStage...")
+		return deleteAddonsHandler(req, model), nil
+	case DeleteFunctionStage:
+		log.Println("Starting DeleteFunctionStage...")
+		return deleteFunctionHandler(req, model), nil
+	case DeleteClusterStage:
+		log.Println("Starting DeleteClusterStage...")
+		return deleteClusterHandler(req, model), nil
+	default:
+		log.Println("Failed to identify stage.")
+		return errorEvent(model, errors.New(fmt.Sprintf("Unhandled stage %s", stage))), nil
+	}
+}
+
+func deleteInit(req handler.Request, model *Model) handler.ProgressEvent {
+	eksClient := eks.New(req.Session)
+	_, err := eksClient.DescribeCluster(&eks.DescribeClusterInput{Name: model.Name})
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	if createsOIDCProvider(model) {
+		err = deleteOIDCProvider(iam.New(req.Session), eksClient, model)
 		if err != nil {
-			return errorEvent(model, err), nil
+			return errorEvent(model, err)
 		}
 	}
-	callback := true
-	if req.CallbackContext == nil {
-		callback = false
+	if exportsKubeConfig(model) {
+		err = deleteKubeConfigSecret(secretsmanager.New(req.Session), model)
+	}
+	return makeEvent(model, DeleteNodeGroupStage, err)
+}
+
+func deleteNodeGroupsHandler(req handler.Request, model *Model) handler.ProgressEvent {
+	nodeGroupsComplete, err := deleteNodeGroups(eks.New(req.Session), model)
+	if nodeGroupsComplete {
+		return makeEvent(model, DeleteFargateProfileStage, err)
+	}
+	return makeEvent(model, DeleteNodeGroupStage, err)
+}
+
+func deleteFargateProfilesHandler(req handler.Request, model *Model) handler.ProgressEvent {
+	profilesComplete, err := deleteFargateProfiles(eks.New(req.Session), model)
+	if profilesComplete {
+		return makeEvent(model, DeleteAddonStage, err)
+	}
+	return makeEvent(model, DeleteFargateProfileStage, err)
+}
+
+func deleteAddonsHandler(req handler.Request, model *Model) handler.ProgressEvent {
+	addonsComplete, err := deleteAddons(eks.New(req.Session), model)
+	if addonsComplete {
+		return makeEvent(model, DeleteFunctionStage, err)
+	}
+	return makeEvent(model, DeleteAddonStage, err)
+}
+
+func deleteFunctionHandler(req handler.Request, model *Model) handler.ProgressEvent {
+	err := deleteFunction(req.Session, model)
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	if isPrivate(model) && usesConfigMap(model) {
+		interfacesComplete, err := functionInterfacesReleased(ec2.New(req.Session), model)
+		if !interfacesComplete || err != nil {
+			return makeEvent(model, DeleteFunctionStage, err)
+		}
+	}
+	if createsConnectorRole(model) {
+		err = releaseConnectorRole(iam.New(req.Session), model, *req.Session.Config.Region)
+	}
+	return makeEvent(model, DeleteClusterStage, err)
+}
+
+func deleteClusterHandler(req handler.Request, model *Model) handler.ProgressEvent {
+	event := deleteCluster(eks.New(req.Session), model)
+	if event.OperationStatus != handler.Success || !deletesLogGroup(model) {
+		return event
+	}
+	err := deleteLogGroup(cloudwatchlogs.New(req.Session), model)
+	if err != nil {
+		return errorEvent(model, err)
 	}
-	return deleteCluster(eks.New(req.Session), model, callback), nil
+	return event
 }
 
 func List(req handler.Request, _ *Model, _ *Model) (handler.ProgressEvent, error) {
 	defer logPanic()
-	progress := listClusters(eks.New(req.Session))
+	progress := listClusters(eks.New(req.Session), req.RequestContext.NextToken)
 	return progress, nil
 }
 
@@ -9,14 +9,27 @@ import (
 type Stage string
 
 const (
-	InitStage          Stage = "Init"
-	LambdaInitStage    Stage = "LambdaInit"
-	ClusterStablilize  Stage = "ClusterStabilize"
-	LambdaStablilize   Stage = "LambdaStabilize"
-	IamAuthStage       Stage = "IamAuthStage"
-	UpdateClusterStage Stage = "UpdateCluster"
-	DeleteClusterStage Stage = "DeleteCluster"
-	CompleteStage      Stage = "Complete"
+	InitStage                 Stage = "Init"
+	LambdaInitStage           Stage = "LambdaInit"
+	ClusterStablilize         Stage = "ClusterStabilize"
+	LambdaStablilize          Stage = "LambdaStabilize"
+	OIDCProviderStage         Stage = "OIDCProviderStage"
+	FargateProfileStage       Stage = "FargateProfileStage"
+	NodeGroupStage            Stage = "NodeGroupStage"
+	AddonStage                Stage = "AddonStage"
+	AccessEntryStage          Stage = "AccessEntryStage"
+	IdentityProviderStage     Stage = "IdentityProviderStage"
+	IamAuthStage              Stage = "IamAuthStage"
+	BootstrapManifestStage    Stage = "BootstrapManifestStage"
+	VersionUpgradeStage       Stage = "VersionUpgrade"
+	UpdateClusterStage        Stage = "UpdateCluster"
+	KubeConfigStage           Stage = "KubeConfigStage"
+	DeleteNodeGroupStage      Stage = "DeleteNodeGroup"
+	DeleteFargateProfileStage Stage = "DeleteFargateProfile"
+	DeleteAddonStage          Stage = "DeleteAddon"
+	DeleteFunctionStage       Stage = "DeleteFunction"
+	DeleteClusterStage        Stage = "DeleteCluster"
+	CompleteStage             Stage = "Complete"
 )
 
 func stabilize(svc eksiface.EKSAPI, desiredModel *Model, desiredState string) (*Model, OperationComplete, string, error) {
@@ -53,3 +66,69 @@ func getStage(context map[string]interface{}) Stage {
 	}
 	return Stage(context["Stage"].(string))
 }
+
+// getVersionUpgrade returns the version upgrade progress stored in the callback context by an earlier invocation.
+func getVersionUpgrade(context map[string]interface{}) *versionUpgrade {
+	upgrade := &versionUpgrade{}
+	if context == nil {
+		return upgrade
+	}
+	upgrade.Plan = getStrings(context["VersionPlan"])
+	// the context is JSON encoded between invocations, so numbers come back as float64
+	switch hop := context["VersionHop"].(type) {
+	case int:
+		upgrade.Hop = hop
+	case float64:
+		upgrade.Hop = int(hop)
+	}
+	upgrade.UpdateId = getUpdateId(context)
+	upgrade.Warnings = getStrings(context["VersionWarnings"])
+	return upgrade
+}
+
+// getClusterName returns the name of the cluster being created, kept in the callback context so that a generated name
+// survives re-invocations.
+func getClusterName(context map[string]interface{}) *string {
+	if context == nil {
+		return nil
+	}
+	if name, ok := context["ClusterName"].(string); ok {
+		return &name
+	}
+	return nil
+}
+
+// getCreateId returns the ID the first invocation of a create gave it and kept in the callback context.
+func getCreateId(context map[string]interface{}) *string {
+	if context == nil {
+		return nil
+	}
+	if id, ok := context["CreateId"].(string); ok {
+		return &id
+	}
+	return nil
+}
+
+// getUpdateId returns the ID of the cluster update an earlier invocation started and kept in the callback context.
+func getUpdateId(context map[string]interface{}) *string {
+	if context == nil {
+		return nil
+	}
+	if id, ok := context["UpdateId"].(string); ok {
+		return &id
+	}
+	return nil
+}
+
+func getStrings(value interface{}) []string {
+	var values []string
+	switch v := value.(type) {
+	case []string:
+		values = v
+	case []interface{}:
+		for _, s := range v {
+			values = append(values, s.(string))
+		}
+	}
+	return values
+}
@@ -0,0 +1,83 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/service/eks"
+)
+
+// validateModel rejects models that EKS would refuse, before any resources are created or changed.
+func validateModel(model *Model) error {
+	if err := validateNetworkConfig(model); err != nil {
+		return err
+	}
+	if err := validatePrivateBootstrap(model); err != nil {
+		return err
+	}
+	if err := validateBootstrapManifests(model); err != nil {
+		return err
+	}
+	return validateAccessEntries(model)
+}
+
+func validateNetworkConfig(model *Model) error {
+	config := model.KubernetesNetworkConfig
+	if config == nil || config.IpFamily == nil || *config.IpFamily != eks.IpFamilyIpv6 {
+		return nil
+	}
+	if config.ServiceIpv4Cidr != nil {
+		return invalidRequestError("ServiceIpv4Cidr cannot be specified when IpFamily is ipv6")
+	}
+	if model.Version != nil {
+		major, minor, err := parseVersion(*model.Version)
+		if err != nil {
+			return invalidRequestError(err.Error())
+		}
+		if major == 1 && minor < 21 {
+			return invalidRequestError("IpFamily ipv6 requires Kubernetes version 1.21 or later")
+		}
+	}
+	return nil
+}
+
+// validateBootstrapManifests requires each manifest to be given either inline or as an S3 URL. Clusters with a private
+// endpoint are only reachable through the VPC connector function, which only exists when aws-auth is used.
+func validateBootstrapManifests(model *Model) error {
+	if len(model.BootstrapManifests) == 0 {
+		return nil
+	}
+	for _, manifest := range model.BootstrapManifests {
+		if (manifest.Content == nil) == (manifest.S3Url == nil) {
+			return invalidRequestError("each of BootstrapManifests requires exactly one of Content and S3Url")
+		}
+		if manifest.S3Url != nil {
+			if _, _, err := parseS3Url(*manifest.S3Url); err != nil {
+				return err
+			}
+		}
+	}
+	if !isPrivate(model) {
+		return nil
+	}
+	if !usesConfigMap(model) {
+		return invalidRequestError("BootstrapManifests on clusters with the public endpoint disabled require the aws-auth ConfigMap")
+	}
+	// manifests in S3 are only checked once downloaded
+	var contents []string
+	for _, manifest := range model.BootstrapManifests {
+		if manifest.Content != nil {
+			contents = append(contents, *manifest.Content)
+		}
+	}
+	return checkConnectorManifestsSize(contents)
+}
+
+func validatePrivateBootstrap(model *Model) error {
+	if !bootstrapsPrivately(model) {
+		return nil
+	}
+	vpc := model.ResourcesVpcConfig
+	if vpc == nil || vpc.EndpointPublicAccess == nil || *vpc.EndpointPublicAccess ||
+		vpc.EndpointPrivateAccess == nil || !*vpc.EndpointPrivateAccess {
+		return invalidRequestError("PrivateBootstrap requires EndpointPublicAccess false and EndpointPrivateAccess true")
+	}
+	return nil
+}
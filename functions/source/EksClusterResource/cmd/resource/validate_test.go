@@ -0,0 +1,97 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"testing"
+)
+
+func TestValidateNetworkConfig(t *testing.T) {
+	tests := map[string]struct {
+		config  *KubernetesNetworkConfig
+		version *string
+		invalid bool
+	}{
+		"no network config": {},
+		"ipv4 with service cidr": {
+			config: &KubernetesNetworkConfig{IpFamily: aws.String(eks.IpFamilyIpv4), ServiceIpv4Cidr: aws.String("10.100.0.0/16")},
+		},
+		"ipv6": {
+			config:  &KubernetesNetworkConfig{IpFamily: aws.String(eks.IpFamilyIpv6)},
+			version: aws.String("1.21"),
+		},
+		"ipv6 with default version": {
+			config: &KubernetesNetworkConfig{IpFamily: aws.String(eks.IpFamilyIpv6)},
+		},
+		"ipv6 with service ipv4 cidr": {
+			config:  &KubernetesNetworkConfig{IpFamily: aws.String(eks.IpFamilyIpv6), ServiceIpv4Cidr: aws.String("10.100.0.0/16")},
+			version: aws.String("1.21"),
+			invalid: true,
+		},
+		"ipv6 before 1.21": {
+			config:  &KubernetesNetworkConfig{IpFamily: aws.String(eks.IpFamilyIpv6)},
+			version: aws.String("1.20"),
+			invalid: true,
+		},
+		"ipv6 with invalid version": {
+			config:  &KubernetesNetworkConfig{IpFamily: aws.String(eks.IpFamilyIpv6)},
+			version: aws.String("latest"),
+			invalid: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateNetworkConfig(&Model{KubernetesNetworkConfig: tc.config, Version: tc.version})
+			if tc.invalid != matchesAwsErrorCode(err, eks.ErrCodeInvalidParameterException) || (!tc.invalid && err != nil) {
+				t.Errorf("expected invalid to be %v, got %v", tc.invalid, err)
+			}
+		})
+	}
+}
+
+func TestValidatePrivateBootstrap(t *testing.T) {
+	tests := map[string]struct {
+		privateBootstrap *bool
+		vpc              *ResourcesVpcConfig
+		invalid          bool
+	}{
+		"not set": {
+			vpc: &ResourcesVpcConfig{EndpointPublicAccess: aws.Bool(true)},
+		},
+		"disabled": {
+			privateBootstrap: aws.Bool(false),
+			vpc:              &ResourcesVpcConfig{EndpointPublicAccess: aws.Bool(true)},
+		},
+		"private endpoint": {
+			privateBootstrap: aws.Bool(true),
+			vpc:              &ResourcesVpcConfig{EndpointPublicAccess: aws.Bool(false), EndpointPrivateAccess: aws.Bool(true)},
+		},
+		"public endpoint": {
+			privateBootstrap: aws.Bool(true),
+			vpc:              &ResourcesVpcConfig{EndpointPublicAccess: aws.Bool(true), EndpointPrivateAccess: aws.Bool(true)},
+			invalid:          true,
+		},
+		"default public endpoint": {
+			privateBootstrap: aws.Bool(true),
+			vpc:              &ResourcesVpcConfig{EndpointPrivateAccess: aws.Bool(true)},
+			invalid:          true,
+		},
+		"no private endpoint": {
+			privateBootstrap: aws.Bool(true),
+			vpc:              &ResourcesVpcConfig{EndpointPublicAccess: aws.Bool(false)},
+			invalid:          true,
+		},
+		"no vpc config": {
+			privateBootstrap: aws.Bool(true),
+			invalid:          true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validatePrivateBootstrap(&Model{PrivateBootstrap: tc.privateBootstrap, ResourcesVpcConfig: tc.vpc})
+			if tc.invalid != matchesAwsErrorCode(err, eks.ErrCodeInvalidParameterException) || (!tc.invalid && err != nil) {
+				t.Errorf("expected invalid to be %v, got %v", tc.invalid, err)
+			}
+		})
+	}
+}
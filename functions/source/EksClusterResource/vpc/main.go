@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/aws-quickstart/quickstart-amazon-eks-cluster-resource-provider/cmd/resource"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -13,18 +12,18 @@ import (
 )
 
 func HandleRequest(_ context.Context, event resource.Event) (*resource.IamAuthMap, error) {
-	eventJson, err := json.Marshal(event)
-	if err != nil {
-		log.Println(err)
-	}
-	log.Println("event: " + string(eventJson))
+	// the event may carry a bearer token and manifests holding secrets, so only identify the request
+	log.Printf("%v event for cluster %v\n", event.Action, aws.StringValue(event.ClusterName))
 	sess, err := session.NewSession(&aws.Config{})
 	if err != nil {
 		return nil, err
 	}
-	token, err := resource.GetToken(sess, event.ClusterName)
-	if err != nil {
-		return nil, err
+	token := event.Token
+	if token == nil {
+		token, err = resource.GetToken(sess, event.ClusterName)
+		if err != nil {
+			return nil, err
+		}
 	}
 	cs, err := resource.CreateKubeClientFromToken(*event.Endpoint, *token, event.CaData)
 	if err != nil {
@@ -37,23 +36,29 @@ func HandleRequest(_ context.Context, event resource.Event) (*resource.IamAuthMa
 	switch event.Action {
 	case resource.CreateAction:
 		fmt.Println("Create event")
-		err := event.AwsAuth.PushConfigMap(cs)
+		err := auth.CreateInCluster(cs)
 		if err != nil {
 			return nil, err
 		}
 	case resource.ReadAction:
 		fmt.Println("Read event")
-		awsAuth, err := event.AwsAuth.GetFromCluster(cs)
+		awsAuth, err := auth.GetFromCluster(cs)
 		if err != nil {
 			return nil, err
 		}
-		event.AwsAuth = awsAuth
+		auth = awsAuth
 	case resource.UpdateAction:
 		fmt.Println("Update event")
 		err := event.AwsAuth.PushConfigMap(cs)
 		if err != nil {
 			return nil, err
 		}
+	case resource.ApplyAction:
+		fmt.Println("Apply event")
+		err := resource.ApplyManifests(cs, event.Manifests)
+		if err != nil {
+			return nil, err
+		}
 	case resource.DeleteAction:
 		fmt.Println("Delete event")
 	case resource.ListAction: